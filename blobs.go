@@ -0,0 +1,196 @@
+package zerogame
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archives are stored once in the cache, in a file named after their SHA-256
+// hash. The entries in each feed's cache directory refer to them by hash.
+const blobsDirName = "blobs"
+
+// blobGracePeriod is how long a stored archive is kept after it was stored or
+// reused, even if no feed refers to it.
+//
+// Archives are stored before the feed's cache directory refers to them, so
+// another zerogame process installing a feed would otherwise lose its archive
+// to a concurrent garbage collection.
+const blobGracePeriod = time.Hour
+
+func (c cache) blobsDir() string {
+	return filepath.Join(c.dir, blobsDirName, "sha256")
+}
+
+// blobPath returns the path of the archive with the hex-encoded SHA-256 hash
+// sum.
+func (c cache) blobPath(sum string) string {
+	return filepath.Join(c.blobsDir(), strings.ToLower(sum))
+}
+
+// putBlob moves the archive at filename into the store and returns its new
+// path. sum is the archive's hex-encoded SHA-256 hash.
+//
+// An archive with the same hash is replaced, in case it was corrupted.
+func (c cache) putBlob(filename, sum string, mode os.FileMode) (string, error) {
+	if _, err := hex.DecodeString(sum); err != nil || sum == "" {
+		return "", fmt.Errorf("invalid SHA-256 hash %q", sum)
+	}
+	ensureDir(c.blobsDir())
+	blob := c.blobPath(sum)
+	if err := os.Chmod(filename, mode); err != nil {
+		return "", err
+	}
+	if err := touchBlob(filename); err != nil {
+		return "", err
+	}
+	if err := os.Rename(filename, blob); err != nil {
+		return "", err
+	}
+	return blob, nil
+}
+
+// reuseBlob looks for feed's archive in the store, so it does not have to be
+// downloaded again for a different feed URL or mirror.
+//
+// The stored archive is verified against feed using method. It returns nil
+// if the archive is not stored or fails verification.
+func (c cache) reuseBlob(ctx context.Context, d *downloader, feed *Feed, method VerificationMethod) *archiveDownload {
+	if feed.ArchiveSHA256 == "" {
+		return nil
+	}
+	blob := c.blobPath(feed.ArchiveSHA256)
+	if err := touchBlob(blob); err != nil {
+		return nil
+	}
+	if method == AutoSelectMethod {
+		method = selectVerificationMethod(feed)
+	}
+	var signature []byte
+	if method == GPGDetachedSignatureMethod {
+		var err error
+		if signature, err = d.getMirrorURL(ctx, feed.signatureURLs()); err != nil {
+			return nil
+		}
+	}
+	dl, err := verifyArchiveFile(feed, blob, signature, method)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Stored archive %s failed verification: %v\n", filepath.Base(blob), err)
+		return nil
+	}
+	return dl
+}
+
+// GarbageCollectCache removes the stored archives that no cached feed refers
+// to, and returns how many bytes were freed.
+//
+// Archives cached by older versions of zerogame are moved into the store
+// first, so identical archives are only stored once.
+func GarbageCollectCache() (int64, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return 0, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return 0, err
+	}
+	if err := cache.migrateToBlobs(reg); err != nil {
+		return 0, err
+	}
+	return cache.collectGarbage(reg)
+}
+
+// migrateToBlobs moves the archives that were cached next to their metadata
+// into the store.
+//
+// Archives cached without metadata are recorded with their current hash, so
+// they can also be verified against it later.
+func (c cache) migrateToBlobs(reg *registry) error {
+	entries, err := c.listEntries(reg)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		a := e.Archive
+		if a.File != a.Path {
+			continue
+		}
+		info, err := os.Stat(a.Path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(a.Path)
+		if err != nil {
+			return err
+		}
+		if a.ArchiveSHA256 != "" && !strings.EqualFold(sum, a.ArchiveSHA256) {
+			fmt.Fprintf(os.Stderr, "Not moving %s: its hash changed since it was downloaded\n", a.Path)
+			continue
+		}
+		if a.ArchiveSHA256 == "" {
+			a.FeedURL = e.FeedURL
+			a.ArchiveSHA256 = sum
+			a.ArchiveSize = info.Size()
+			a.DownloadedAt = info.ModTime()
+			if err := a.writeMeta(); err != nil {
+				return err
+			}
+		}
+		if _, err := c.putBlob(a.Path, sum, info.Mode()); err != nil {
+			return fmt.Errorf("failed to move %s: %w", a.Path, err)
+		}
+	}
+	return nil
+}
+
+// touchBlob records that the stored archive at filename is used now, so it is
+// not garbage collected within blobGracePeriod.
+func touchBlob(filename string) error {
+	now := time.Now()
+	return os.Chtimes(filename, now, now)
+}
+
+// collectGarbage removes the stored archives that no cached feed refers to.
+//
+// Archives stored or reused within blobGracePeriod are kept.
+func (c cache) collectGarbage(reg *registry) (int64, error) {
+	cutoff := time.Now().Add(-blobGracePeriod)
+	blobs, err := ioutil.ReadDir(c.blobsDir())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	entries, err := c.listEntries(reg)
+	if err != nil {
+		return 0, err
+	}
+	referenced := map[string]bool{}
+	for _, e := range entries {
+		referenced[e.Archive.File] = true
+	}
+	var freed int64
+	for _, blob := range blobs {
+		filename := filepath.Join(c.blobsDir(), blob.Name())
+		if referenced[filename] {
+			continue
+		}
+		// The archive may have been reused since the directory was read.
+		info, err := os.Stat(filename)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			return freed, err
+		}
+		freed += info.Size()
+	}
+	return freed, nil
+}
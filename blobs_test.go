@@ -0,0 +1,55 @@
+package zerogame
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbageKeepsRecentBlobs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestBlob := func(sum string) string {
+		t.Helper()
+		filename := filepath.Join(t.TempDir(), "game.zip")
+		if err := ioutil.WriteFile(filename, []byte(sum), 0644); err != nil {
+			t.Fatal(err)
+		}
+		blob, err := c.putBlob(filename, sum, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blob
+	}
+	// The recent archive was stored by an install that has not recorded it in
+	// its feed's cache directory yet.
+	recent := putTestBlob("aaaa")
+	old := putTestBlob("bbbb")
+	stored := time.Now().Add(-2 * blobGracePeriod)
+	if err := os.Chtimes(old, stored, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := c.loadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	freed, err := c.collectGarbage(reg)
+	if err != nil {
+		t.Fatalf("collectGarbage() = %v", err)
+	}
+	if freed != 4 {
+		t.Errorf("collectGarbage() freed %d bytes, want 4", freed)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("the recent archive was removed: %v", err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("the unused archive was not removed: %v", err)
+	}
+}
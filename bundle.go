@@ -0,0 +1,401 @@
+package zerogame
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A bundle is a zip file with a manifest, and the cached feed documents,
+// archives and signatures of the feeds listed in it. Each feed's files are in
+// a directory named after its feed ID, laid out as in the cache.
+const (
+	bundleManifestName  = "manifest.json"
+	bundleFormatVersion = 1
+)
+
+type bundleManifest struct {
+	FormatVersion int           `json:"format_version"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Feeds         []bundledFeed `json:"feeds"`
+}
+
+type bundledFeed struct {
+	// FeedURL is the feed's URL.
+	FeedURL string `json:"feed_url"`
+
+	// Archive is the name of the feed's archive.
+	Archive string `json:"archive"`
+}
+
+// dir returns the directory of the feed's files in the bundle.
+func (f *bundledFeed) dir() string {
+	return uniqueFeedID(f.FeedURL)
+}
+
+// BundledArchive describes an archive that was exported to or imported from
+// a bundle.
+type BundledArchive struct {
+	// FeedURL is the URL of the feed the archive belongs to.
+	FeedURL string
+
+	// Name and Version are the name and version of the archive's release.
+	Name    string
+	Version string
+
+	// Err is the reason the archive was not imported, or nil if it was.
+	Err error
+}
+
+// ExportBundle writes the cached archives of the given feeds, their
+// signatures and the cached feed documents to a bundle at filename.
+//
+// Each feed is given by its URL or by the name of an installed feed. Its
+// cached archive is exported, which is the installed archive unless a newer
+// one was downloaded.
+func ExportBundle(filename string, feedURLsOrNames []string) ([]BundledArchive, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := bundleManifest{FormatVersion: bundleFormatVersion, CreatedAt: time.Now()}
+	var exported []BundledArchive
+	var archives []*CachedArchive
+	seen := map[string]bool{}
+	for _, arg := range feedURLsOrNames {
+		feedURL := normalizeFeedURL(arg)
+		if installed, err := reg.find(arg); err == nil {
+			feedURL = installed.FeedURL
+		}
+		if seen[feedURL] {
+			continue
+		}
+		seen[feedURL] = true
+		cached, err := cache.GetFeedArchive(feedURL)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not cached", arg)
+		}
+		if cached.Feed.Version == "" || cached.FeedDocumentPath == "" {
+			return nil, fmt.Errorf("the cached archive of %s has no feed document. Install it again to cache one", feedURL)
+		}
+		manifest.Feeds = append(manifest.Feeds, bundledFeed{FeedURL: feedURL, Archive: filepath.Base(cached.Path)})
+		archives = append(archives, cached)
+		exported = append(exported, BundledArchive{FeedURL: feedURL, Name: cached.Feed.Name, Version: cached.Feed.Version})
+	}
+	if len(archives) == 0 {
+		return nil, errors.New("no feeds to export")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	err = cache.writeBundle(tmp, &manifest, archives)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return nil, err
+	}
+	return exported, nil
+}
+
+func (c cache) writeBundle(w io.Writer, manifest *bundleManifest, archives []*CachedArchive) error {
+	zw := zip.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, bundleManifestName, data); err != nil {
+		return err
+	}
+	for i, cached := range archives {
+		f := &manifest.Feeds[i]
+		if data, _ := c.readCachedFeed(f.FeedURL); data != nil {
+			for _, name := range []string{feedDocumentName, feedMetaName} {
+				if err := addZipFile(zw, path.Join(f.dir(), name), filepath.Join(c.feedDir(f.FeedURL), name), zip.Deflate); err != nil {
+					return err
+				}
+			}
+		}
+		// Archives are usually compressed already.
+		if err := addZipFile(zw, path.Join(f.dir(), f.Archive), cached.File, zip.Store); err != nil {
+			return err
+		}
+		if err := addZipFile(zw, path.Join(f.dir(), f.Archive+cachedFeedSuffix), cached.FeedDocumentPath, zip.Deflate); err != nil {
+			return err
+		}
+		if cached.SignaturePath != "" {
+			if err := addZipFile(zw, path.Join(f.dir(), f.Archive+cachedSignatureSuffix), cached.SignaturePath, zip.Store); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// addZipFile adds the file at filename to zw as name.
+func addZipFile(zw *zip.Writer, name, filename string, method uint16) error {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = method
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, fd)
+	return err
+}
+
+// ErrUnsignedArchive is returned when a bundle contains an archive without a
+// GPG signature and unsigned archives are not allowed.
+var ErrUnsignedArchive = errors.New("archive is not signed")
+
+// ImportBundleOptions configures a call to ImportBundle.
+type ImportBundleOptions struct {
+	// VerificationMethod controls how an archive is verified.
+	//
+	// Defaults to AutoSelectMethod.
+	VerificationMethod VerificationMethod
+
+	// AllowUnsigned imports archives that have no GPG signature.
+	//
+	// Their feed documents come from the bundle too, so their checksums only
+	// detect damaged archives, not archives modified by whoever made the
+	// bundle.
+	AllowUnsigned bool
+}
+
+// ImportBundle loads the feed documents, archives and signatures in the
+// bundle at filename into the cache, so the feeds can be installed offline.
+//
+// Each archive is verified against its feed before it is added to the cache,
+// the same way it would be verified when it is downloaded. Archives that fail
+// verification are not imported. Archives without a GPG signature are only
+// imported if opts.AllowUnsigned is set, and feeds must match the feed IDs
+// and signing keys seen on this machine before.
+//
+// ImportBundle returns every archive in the bundle, and an error if some of
+// them were not imported.
+func ImportBundle(filename string, opts ImportBundleOptions) ([]BundledArchive, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle %s: %w", filename, err)
+	}
+	defer zr.Close()
+	b := &bundleReader{files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		b.files[f.Name] = f
+	}
+
+	data, err := b.read(bundleManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a zerogame bundle: %w", filename, err)
+	}
+	var manifest bundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s has an invalid manifest: %w", filename, err)
+	}
+	if manifest.FormatVersion != bundleFormatVersion {
+		return nil, fmt.Errorf("%s has unsupported format version %d", filename, manifest.FormatVersion)
+	}
+
+	var imported []BundledArchive
+	var didFail bool
+	for i := range manifest.Feeds {
+		f := &manifest.Feeds[i]
+		result := BundledArchive{FeedURL: f.FeedURL}
+		feed, err := cache.importBundledFeed(b, f, opts)
+		if feed != nil {
+			result.Name, result.Version = feed.Name, feed.Version
+		}
+		if err != nil {
+			didFail = true
+			result.Err = err
+			if result.Name == "" {
+				result.Name = strings.TrimSuffix(f.Archive, path.Ext(f.Archive))
+			}
+		}
+		imported = append(imported, result)
+	}
+	if didFail {
+		return imported, errors.New("some archives were not imported")
+	}
+	return imported, nil
+}
+
+// importBundledFeed verifies a feed's archive in a bundle and adds it to the
+// cache. It returns the release the archive belongs to, if it was found.
+func (c cache) importBundledFeed(b *bundleReader, f *bundledFeed, opts ImportBundleOptions) (*Feed, error) {
+	if f.FeedURL == "" || !isCachedArchiveName(f.Archive) || path.Base(f.Archive) != f.Archive || strings.ContainsAny(f.Archive, `/\`) {
+		return nil, fmt.Errorf("invalid archive name %q", f.Archive)
+	}
+	archiveDoc, err := b.read(path.Join(f.dir(), f.Archive+cachedFeedSuffix))
+	if err != nil {
+		return nil, err
+	}
+	feed, err := parseFeed(f.FeedURL, archiveDoc)
+	if err != nil {
+		return nil, fmt.Errorf("bundled feed is invalid: %w", err)
+	}
+	feed, err = findArchiveRelease(feed, f.Archive)
+	if err != nil {
+		return nil, err
+	}
+	// The bundled feed document is no more trustworthy than the archive, so
+	// it must not change the feed's ID or signing key.
+	if err := c.checkFeedIdentity(f.FeedURL, feed); err != nil {
+		return feed, err
+	}
+	method := opts.VerificationMethod
+	if method == "" || method == AutoSelectMethod {
+		method = selectVerificationMethod(feed)
+	}
+	if method != GPGDetachedSignatureMethod && !opts.AllowUnsigned {
+		return feed, fmt.Errorf("%w: %s can only be verified against the bundle itself", ErrUnsignedArchive, f.Archive)
+	}
+
+	archive, ok := b.files[path.Join(f.dir(), f.Archive)]
+	if !ok {
+		return feed, fmt.Errorf("bundle has no file %s", path.Join(f.dir(), f.Archive))
+	}
+	var signature []byte
+	if _, ok := b.files[path.Join(f.dir(), f.Archive+cachedSignatureSuffix)]; ok {
+		if signature, err = b.read(path.Join(f.dir(), f.Archive+cachedSignatureSuffix)); err != nil {
+			return feed, err
+		}
+	}
+
+	c.ensureFeedDir(f.FeedURL)
+	tmp, err := ioutil.TempFile(c.feedDir(f.FeedURL), f.Archive+".*.part")
+	if err != nil {
+		return feed, err
+	}
+	defer os.Remove(tmp.Name())
+	err = extractZipFile(archive, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return feed, fmt.Errorf("failed to extract %s: %w", f.Archive, err)
+	}
+	dl, err := verifyArchiveFile(feed, tmp.Name(), signature, method)
+	if err != nil {
+		return feed, fmt.Errorf("failed to verify %s: %w", f.Archive, err)
+	}
+
+	if err := c.importBundledFeedDocument(b, f, archiveDoc); err != nil {
+		return feed, err
+	}
+	if err := c.WriteFeedArchive(f.FeedURL, feed, tmp.Name(), 0755, dl); err != nil {
+		return feed, err
+	}
+	// Keep the feed document the archive was downloaded for, which may be
+	// older than the feed document in the cache.
+	archivePath := filepath.Join(c.feedDir(f.FeedURL), f.Archive)
+	return feed, writeFileAtomic(archivePath+cachedFeedSuffix, archiveDoc, 0644)
+}
+
+// importBundledFeedDocument caches the bundled copy of a feed's document,
+// unless the cache has a more recent copy.
+//
+// If the bundle has no copy, the feed document the archive was downloaded for
+// is cached instead.
+func (c cache) importBundledFeedDocument(b *bundleReader, f *bundledFeed, archiveDoc []byte) error {
+	doc, meta := archiveDoc, feedMeta{URL: f.FeedURL}
+	if data, err := b.read(path.Join(f.dir(), feedDocumentName)); err == nil {
+		var bundledMeta feedMeta
+		if metaData, err := b.read(path.Join(f.dir(), feedMetaName)); err == nil && json.Unmarshal(metaData, &bundledMeta) == nil && bundledMeta.URL == f.FeedURL {
+			doc, meta = data, bundledMeta
+		}
+	}
+	if _, err := parseFeed(f.FeedURL, doc); err != nil {
+		return fmt.Errorf("bundled feed is invalid: %w", err)
+	}
+	if cached, cachedMeta := c.readCachedFeed(f.FeedURL); cached != nil && !cachedMeta.FetchedAt.Before(meta.FetchedAt) {
+		return nil
+	}
+	return c.writeCachedFeed(f.FeedURL, doc, meta)
+}
+
+// findArchiveRelease returns the release of feed whose archive for this
+// platform is named archiveName.
+func findArchiveRelease(feed *Feed, archiveName string) (*Feed, error) {
+	for _, r := range feed.AllReleases() {
+		release, err := selectRelease(feed, r.Version, "")
+		if err == nil && feedArchiveName(release) == archiveName {
+			return release, nil
+		}
+	}
+	return nil, fmt.Errorf("the feed has no release with archive %s for this platform", archiveName)
+}
+
+type bundleReader struct {
+	files map[string]*zip.File
+}
+
+// read returns the contents of the file named name in the bundle.
+func (b *bundleReader) read(name string) ([]byte, error) {
+	f, ok := b.files[name]
+	if !ok {
+		return nil, fmt.Errorf("bundle has no file %s", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func extractZipFile(f *zip.File, w io.Writer) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,173 @@
+package zerogame
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testBundleFeedURL = "https://example.com/game/feed.json"
+
+// testBundledArchive is an archive in a bundle made by newTestBundle.
+type testBundledArchive struct {
+	feed      Feed
+	archive   []byte
+	signature []byte
+}
+
+// newTestBundle writes a bundle with a, downloaded from testBundleFeedURL,
+// and returns its filename.
+func newTestBundle(t *testing.T, a testBundledArchive) string {
+	t.Helper()
+	f := bundledFeed{FeedURL: testBundleFeedURL, Archive: feedArchiveName(&a.feed)}
+	filename := filepath.Join(t.TempDir(), "games.zgb")
+	fd, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	zw := zip.NewWriter(fd)
+	manifest, err := json.Marshal(bundleManifest{FormatVersion: bundleFormatVersion, CreatedAt: time.Now(), Feeds: []bundledFeed{f}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := json.Marshal(a.feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		bundleManifestName:                             manifest,
+		path.Join(f.dir(), f.Archive):                  a.archive,
+		path.Join(f.dir(), f.Archive+cachedFeedSuffix): doc,
+	}
+	if a.signature != nil {
+		files[path.Join(f.dir(), f.Archive+cachedSignatureSuffix)] = a.signature
+	}
+	for name, data := range files {
+		if err := writeZipFile(zw, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// newTestFeed returns a feed for archive with its checksum.
+func newTestFeed(archive []byte) Feed {
+	sum := sha256.Sum256(archive)
+	return Feed{Name: "game", Release: Release{Version: "1.0", Archive: Archive{
+		ArchiveURL:    "https://example.com/game/game.zip",
+		ArchiveType:   "zip",
+		ArchiveSHA256: hex.EncodeToString(sum[:]),
+		ArchiveSize:   int64(len(archive)),
+	}}}
+}
+
+// importTestBundle imports filename and returns the error of its only archive.
+func importTestBundle(t *testing.T, filename string, opts ImportBundleOptions) error {
+	t.Helper()
+	imported, err := ImportBundle(filename, opts)
+	if len(imported) != 1 {
+		t.Fatalf("ImportBundle() returned %d archives, %v, want 1", len(imported), err)
+	}
+	if (err == nil) != (imported[0].Err == nil) {
+		t.Fatalf("ImportBundle() = %v, but its archive failed with %v", err, imported[0].Err)
+	}
+	return imported[0].Err
+}
+
+func TestImportBundleRefusesUnsignedArchives(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	archive := []byte("archive contents")
+	bundle := newTestBundle(t, testBundledArchive{feed: newTestFeed(archive), archive: archive})
+
+	err := importTestBundle(t, bundle, ImportBundleOptions{})
+	if !errors.Is(err, ErrUnsignedArchive) {
+		t.Fatalf("ImportBundle() = %v, want %v", err, ErrUnsignedArchive)
+	}
+	if err := importTestBundle(t, bundle, ImportBundleOptions{AllowUnsigned: true}); err != nil {
+		t.Fatalf("ImportBundle() with AllowUnsigned = %v", err)
+	}
+}
+
+func TestImportBundleVerifiesSignedArchives(t *testing.T) {
+	trusted := newTestKey(t, "trusted")
+	useTestKeyRing(t, trusted)
+	archive := []byte("archive contents")
+	feed := newTestFeed(archive)
+	feed.GPGSignatureURL = "https://example.com/game/game.zip.sig"
+
+	signed := newTestBundle(t, testBundledArchive{feed: feed, archive: archive, signature: signDetached(t, trusted, archive)})
+	if err := importTestBundle(t, signed, ImportBundleOptions{}); err != nil {
+		t.Fatalf("ImportBundle() = %v", err)
+	}
+
+	// Whoever made the bundle replaces the archive, and makes its feed
+	// document match by updating the checksum and removing the signature.
+	tampered := []byte("modified archive contents")
+	tamperedFeed := newTestFeed(tampered)
+	bundle := newTestBundle(t, testBundledArchive{feed: tamperedFeed, archive: tampered})
+	if err := importTestBundle(t, bundle, ImportBundleOptions{}); !errors.Is(err, ErrUnsignedArchive) {
+		t.Fatalf("ImportBundle() of a tampered bundle = %v, want %v", err, ErrUnsignedArchive)
+	}
+
+	// A modified archive with the original signature fails verification.
+	feed.ArchiveSHA256, feed.ArchiveSize = tamperedFeed.ArchiveSHA256, tamperedFeed.ArchiveSize
+	bundle = newTestBundle(t, testBundledArchive{feed: feed, archive: tampered, signature: signDetached(t, trusted, archive)})
+	if err := importTestBundle(t, bundle, ImportBundleOptions{}); err == nil {
+		t.Fatal("ImportBundle() of a modified signed archive succeeded")
+	}
+}
+
+func TestImportBundleChecksFeedIdentity(t *testing.T) {
+	trusted, other := newTestKey(t, "trusted"), newTestKey(t, "other")
+	useTestKeyRing(t, trusted, other)
+	archive := []byte("archive contents")
+
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := c.loadIdentities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Feeds = append(x.Feeds, feedIdentity{
+		ID:         "com.example.game",
+		SigningKey: trusted.GetFingerprint(),
+		URL:        testBundleFeedURL,
+		URLs:       []string{testBundleFeedURL},
+	})
+	if err := x.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		signingKey string
+	}{
+		{name: "ID removed", signingKey: other.GetFingerprint()},
+		{name: "signing key replaced", id: "com.example.game", signingKey: other.GetFingerprint()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := newTestFeed(archive)
+			feed.ID, feed.SigningKey = tt.id, tt.signingKey
+			feed.GPGSignatureURL = "https://example.com/game/game.zip.sig"
+			bundle := newTestBundle(t, testBundledArchive{feed: feed, archive: archive, signature: signDetached(t, other, archive)})
+			if err := importTestBundle(t, bundle, ImportBundleOptions{}); !errors.Is(err, ErrFeedIdentity) {
+				t.Fatalf("ImportBundle() = %v, want %v", err, ErrFeedIdentity)
+			}
+		})
+	}
+}
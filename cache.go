@@ -1,25 +1,42 @@
 package zerogame
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-const markerName = "marker.zg"
+const (
+	markerName  = "marker.zg"
+	feedURLName = "feed_url.txt"
+)
+
+// cache is the directory feeds and archives are cached in.
+//
+// Each operation creates its own cache with newDefaultCache, so files that
+// are read often, like the feed IDs, are loaded once per operation.
+type cache struct {
+	dir string
 
-type cache string
+	// identities is the feed IDs seen on this machine. It is loaded the
+	// first time it is used.
+	identities *identities
+}
 
 func newDefaultCache() (cache, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("could not get the user's home directory: %w", err)
+		return cache{}, fmt.Errorf("could not get the user's home directory: %w", err)
 	}
-	return cache(filepath.Join(home, ".zerogame")), nil
+	dir := filepath.Join(home, ".zerogame")
+	return cache{dir: dir, identities: &identities{filename: filepath.Join(dir, identitiesName)}}, nil
 }
 
 func (c cache) FeedArchiveExists(feedURL string) bool {
@@ -27,39 +44,237 @@ func (c cache) FeedArchiveExists(feedURL string) bool {
 	return err == nil
 }
 
-func (c cache) GetFeedArchive(feedURL string) (string, error) {
+// CachedArchive describes an archive in the cache.
+//
+// Archives cached by older versions of zerogame only have a Path.
+type CachedArchive struct {
+	// FeedURL is the URL of the feed the archive was downloaded for.
+	FeedURL string `json:"feed_url"`
+
+	// Path is the archive's path in the feed's cache directory. The archive
+	// is installed next to it, in a directory named after it.
+	Path string `json:"-"`
+
+	// File is the path of the archive's contents. It is in the store of
+	// archives shared by every feed, or Path for archives cached by older
+	// versions of zerogame.
+	File string `json:"-"`
+
+	// Feed is the release the archive was downloaded for, with a single
+	// archive.
+	Feed Feed `json:"feed"`
+
+	// ArchiveSHA256 is the hex-encoded SHA-256 hash of the archive.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+
+	// ArchiveSize is the size of the archive in bytes.
+	ArchiveSize int64 `json:"archive_size,omitempty"`
+
+	// VerificationMethod is how the archive was verified when it was
+	// downloaded.
+	VerificationMethod VerificationMethod `json:"verification_method,omitempty"`
+
+	// DownloadedAt is when the archive was downloaded.
+	DownloadedAt time.Time `json:"downloaded_at"`
+
+	// LastUsedAt is when the archive was last installed.
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+
+	// FeedDocumentPath is the path of a copy of the feed document the
+	// archive was downloaded for, or empty if there is none.
+	FeedDocumentPath string `json:"-"`
+
+	// SignaturePath is the path of the archive's GPG signature, or empty if
+	// there is none.
+	SignaturePath string `json:"-"`
+}
+
+// Suffixes of the files stored next to a cached archive.
+const (
+	cachedMetaSuffix      = ".json"
+	cachedFeedSuffix      = ".feed.json"
+	cachedSignatureSuffix = ".sig"
+)
+
+// GetFeedArchive returns the cached archive of feedURL.
+func (c cache) GetFeedArchive(feedURL string) (*CachedArchive, error) {
 	marker := filepath.Join(c.feedDir(feedURL), markerName)
 	if _, err := os.Stat(marker); os.IsNotExist(err) {
-		return "", errors.New("not found")
+		return nil, errors.New("not found")
 	}
 	basename, err := ioutil.ReadFile(marker)
 	if err != nil {
-		return "", errors.New("failed to read marker")
+		return nil, errors.New("failed to read marker")
+	}
+	return c.readCachedArchive(feedURL, filepath.Join(c.feedDir(feedURL), string(basename)))
+}
+
+// readCachedArchive reads the metadata of the cached archive at archivePath.
+func (c cache) readCachedArchive(feedURL, archivePath string) (*CachedArchive, error) {
+	cached := &CachedArchive{FeedURL: feedURL}
+	if data, err := ioutil.ReadFile(archivePath + cachedMetaSuffix); err == nil {
+		if err := json.Unmarshal(data, cached); err != nil {
+			return nil, fmt.Errorf("failed to read the metadata of %s: %w", archivePath, err)
+		}
+	}
+	cached.Path = archivePath
+	if cached.ArchiveSHA256 != "" {
+		if _, err := os.Stat(c.blobPath(cached.ArchiveSHA256)); err == nil {
+			cached.File = c.blobPath(cached.ArchiveSHA256)
+		}
+	}
+	if cached.File == "" {
+		if _, err := os.Stat(archivePath); err != nil {
+			return nil, errors.New("not found")
+		}
+		cached.File = archivePath
+	}
+	if _, err := os.Stat(archivePath + cachedFeedSuffix); err == nil {
+		cached.FeedDocumentPath = archivePath + cachedFeedSuffix
 	}
-	filename := filepath.Join(c.feedDir(feedURL), string(basename))
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return "", errors.New("not found")
+	if _, err := os.Stat(archivePath + cachedSignatureSuffix); err == nil {
+		cached.SignaturePath = archivePath + cachedSignatureSuffix
 	}
-	return filename, nil
+	return cached, nil
 }
 
-func (c cache) WriteFeedArchive(feedURL string, feed *Feed, archive []byte, mode os.FileMode) error {
-	ensureDir(c.feedDir(feedURL))
-	basename := fmt.Sprintf("%s-%s.%s", feed.Name, feed.Version, feed.ArchiveType)
-	filename := filepath.Join(c.feedDir(feedURL), basename)
-	fmt.Fprintf(os.Stderr, "Writing feed archive to %s...\n", filename)
-	if err := ioutil.WriteFile(filename, archive, mode); err != nil {
+// sha256 returns the hex-encoded SHA-256 hash of the archive, computing it
+// if it was not recorded when the archive was downloaded.
+func (a *CachedArchive) sha256() (string, error) {
+	if a.ArchiveSHA256 != "" {
+		return a.ArchiveSHA256, nil
+	}
+	return fileSHA256(a.File)
+}
+
+// writeMeta writes the metadata stored next to the archive.
+func (a *CachedArchive) writeMeta() error {
+	meta, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
 		return err
 	}
-	marker := filepath.Join(c.feedDir(feedURL), markerName)
-	if err := ioutil.WriteFile(marker, []byte(basename), 0755); err != nil {
+	return writeFileAtomic(a.Path+cachedMetaSuffix, meta, 0644)
+}
+
+// touch records that the archive was used now.
+//
+// Archives without metadata are not touched; the modification time of the
+// archive is used as their last use instead.
+func (a *CachedArchive) touch() error {
+	if a.Feed.Version == "" {
+		return nil
+	}
+	a.LastUsedAt = time.Now()
+	return a.writeMeta()
+}
+
+// removeCachedArchive removes the cached archive at archivePath and the files
+// stored next to it.
+//
+// The archive's contents stay in the store until they are garbage collected.
+func removeCachedArchive(archivePath string) {
+	for _, suffix := range []string{"", cachedMetaSuffix, cachedFeedSuffix, cachedSignatureSuffix} {
+		os.Remove(archivePath + suffix)
+	}
+}
+
+// OpenPartialFeedArchive opens the partially downloaded archive of feed in
+// feedURL's cache directory, creating it if it does not exist.
+func (c cache) OpenPartialFeedArchive(feedURL string, feed *Feed) (*partialFile, error) {
+	c.ensureFeedDir(feedURL)
+	filename := filepath.Join(c.feedDir(feedURL), feedArchiveName(feed)+".part")
+	fd, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &partialFile{File: fd}, nil
+}
+
+// WriteFeedArchive moves the downloaded archive at filename into the cache.
+//
+// The archive is stored by its hash, and the feed refers to it.
+func (c cache) WriteFeedArchive(feedURL string, feed *Feed, filename string, mode os.FileMode, dl *archiveDownload) error {
+	blob, err := c.putBlob(filename, hex.EncodeToString(dl.sha256), mode)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote feed archive to %s\n", blob)
+	os.Remove(partialMetaPath(filename))
+	return c.writeFeedEntry(feedURL, feed, dl)
+}
+
+// writeFeedEntry makes the stored archive of dl the cached archive of feed.
+//
+// The feed, the copy of the feed document in the cache and the archive's
+// signature are stored in feedURL's cache directory.
+func (c cache) writeFeedEntry(feedURL string, feed *Feed, dl *archiveDownload) error {
+	c.ensureFeedDir(feedURL)
+	basename := feedArchiveName(feed)
+	archivePath := filepath.Join(c.feedDir(feedURL), basename)
+	removeCachedArchive(archivePath)
+
+	cached := CachedArchive{
+		FeedURL:            feedURL,
+		Path:               archivePath,
+		Feed:               *feed,
+		ArchiveSHA256:      hex.EncodeToString(dl.sha256),
+		ArchiveSize:        dl.size,
+		VerificationMethod: dl.method,
+		DownloadedAt:       time.Now(),
+	}
+	if err := cached.writeMeta(); err != nil {
 		return err
 	}
-	return nil
+	if data, _ := c.readCachedFeed(feedURL); data != nil {
+		if err := writeFileAtomic(archivePath+cachedFeedSuffix, data, 0644); err != nil {
+			return err
+		}
+	}
+	if dl.signature != nil {
+		if err := writeFileAtomic(archivePath+cachedSignatureSuffix, dl.signature, 0644); err != nil {
+			return err
+		}
+	}
+
+	return c.writeMarker(feedURL, basename)
+}
+
+// writeMarker makes the archive named basename the cached archive of feedURL.
+func (c cache) writeMarker(feedURL, basename string) error {
+	marker := filepath.Join(c.feedDir(feedURL), markerName)
+	return writeFileAtomic(marker, []byte(basename), 0755)
 }
 
+func feedArchiveName(feed *Feed) string {
+	return fmt.Sprintf("%s-%s.%s", feed.Name, feed.Version, feed.ArchiveType)
+}
+
+// feedDir returns the cache directory of feedURL.
+//
+// Feeds with an ID share the directory they were last installed from,
+// whichever of their URLs they are fetched from. Other feeds have a directory
+// named after their URL.
 func (c cache) feedDir(feedURL string) string {
-	return filepath.Join(string(c), uniqueFeedID(feedURL))
+	if ident := c.identityOf(feedURL); ident != nil {
+		return filepath.Join(c.dir, ident.dir())
+	}
+	return filepath.Join(c.dir, uniqueFeedID(feedURL))
+}
+
+// ensureFeedDir creates the cache directory of feedURL and records the feed
+// URL in it, since the directory's name is derived from a hash.
+//
+// The directory of a feed with an ID records the feed's canonical URL.
+func (c cache) ensureFeedDir(feedURL string) {
+	dir := c.feedDir(feedURL)
+	ensureDir(dir)
+	if ident := c.identityOf(feedURL); ident != nil {
+		feedURL = ident.URL
+	}
+	filename := filepath.Join(dir, feedURLName)
+	if data, err := ioutil.ReadFile(filename); err != nil || string(data) != feedURL {
+		writeFileAtomic(filename, []byte(feedURL), 0644)
+	}
 }
 
 func ensureDir(p string) {
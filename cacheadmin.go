@@ -0,0 +1,488 @@
+package zerogame
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CacheEntry describes an archive in the cache.
+type CacheEntry struct {
+	// FeedURL is the URL of the feed the archive was downloaded for, or empty
+	// if it is unknown.
+	FeedURL string
+
+	// FeedID is the name of the feed's directory in the cache.
+	FeedID string
+
+	// Name and Version are the name and version of the archive's release.
+	Name    string
+	Version string
+
+	// Size is the size of the archive and the files stored next to it, in
+	// bytes. An archive shared by several entries is counted in each of
+	// them; see CacheSize.
+	Size int64
+
+	// LastUsed is when the archive was last installed or downloaded.
+	LastUsed time.Time
+
+	// Installed is true if the archive is installed.
+	//
+	// Installed archives are never pruned.
+	Installed bool
+
+	// Archive is the cached archive.
+	Archive *CachedArchive
+
+	// fileSize is the size of the archive's contents.
+	fileSize int64
+}
+
+// ListCache returns the archives in the cache, sorted by feed and version.
+func ListCache() ([]CacheEntry, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return cache.listEntries(reg)
+}
+
+func (c cache) listEntries(reg *registry) ([]CacheEntry, error) {
+	dirs, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []CacheEntry
+	for _, dir := range dirs {
+		if !dir.IsDir() || !isFeedID(dir.Name()) {
+			continue
+		}
+		feedEntries, err := c.listFeedEntries(reg, dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, feedEntries...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FeedURL != entries[j].FeedURL {
+			return entries[i].FeedURL < entries[j].FeedURL
+		}
+		return entries[i].Archive.Path < entries[j].Archive.Path
+	})
+	return entries, nil
+}
+
+// listFeedEntries returns the archives in the cache directory named id.
+func (c cache) listFeedEntries(reg *registry, id string) ([]CacheEntry, error) {
+	dir := filepath.Join(c.dir, id)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	feedURL := c.recoverFeedURL(reg, id)
+	var names []string
+	seen := map[string]bool{}
+	for _, file := range files {
+		name := file.Name()
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		// Stored archives are only recorded by their metadata.
+		if isCachedMetaName(name) {
+			name = strings.TrimSuffix(name, cachedMetaSuffix)
+		}
+		if isCachedArchiveName(name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	var entries []CacheEntry
+	for _, name := range names {
+		archivePath := filepath.Join(dir, name)
+		cached, err := c.readCachedArchive(feedURL, archivePath)
+		if err != nil {
+			// The entry's archive is missing.
+			continue
+		}
+		if feedURL == "" {
+			feedURL = cached.FeedURL
+		}
+		entry := CacheEntry{
+			FeedURL:  cached.FeedURL,
+			FeedID:   id,
+			Name:     cached.Feed.Name,
+			Version:  cached.Feed.Version,
+			LastUsed: cached.LastUsedAt,
+			Archive:  cached,
+		}
+		if info, err := os.Stat(cached.File); err == nil {
+			entry.fileSize = info.Size()
+		}
+		entry.Size = entry.fileSize + sidecarSize(cached)
+		if entry.LastUsed.Before(cached.DownloadedAt) {
+			entry.LastUsed = cached.DownloadedAt
+		}
+		if entry.LastUsed.IsZero() {
+			if info, err := os.Stat(cached.File); err == nil {
+				entry.LastUsed = info.ModTime()
+			}
+		}
+		for _, f := range reg.Feeds {
+			if f.ArchivePath != archivePath {
+				continue
+			}
+			entry.Installed = true
+			if entry.FeedURL == "" {
+				entry.FeedURL = f.FeedURL
+			}
+			if entry.Name == "" {
+				entry.Name, entry.Version = f.Name, f.Version
+			}
+			if entry.LastUsed.Before(f.InstalledAt) {
+				entry.LastUsed = f.InstalledAt
+			}
+		}
+		if entry.Name == "" {
+			// Archives cached by older versions of zerogame have no metadata.
+			entry.Name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// CacheSize returns the disk space used by entries in bytes, counting
+// archives shared by several entries once.
+func CacheSize(entries []CacheEntry) int64 {
+	var size int64
+	files := map[string]bool{}
+	for _, e := range entries {
+		size += e.Size
+		if files[e.Archive.File] {
+			size -= e.fileSize
+		}
+		files[e.Archive.File] = true
+	}
+	return size
+}
+
+// sidecarSize returns the size of the files stored next to an archive.
+func sidecarSize(a *CachedArchive) int64 {
+	var size int64
+	for _, suffix := range []string{cachedMetaSuffix, cachedFeedSuffix, cachedSignatureSuffix} {
+		if info, err := os.Stat(a.Path + suffix); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// recoverFeedURL returns the URL of the feed whose cache directory is named
+// id, or the empty string if it is unknown.
+//
+// Directories created by older versions of zerogame do not record their feed
+// URL, so it is looked up in the cached feed document and in the registry.
+// The directory of a feed with an ID belongs to the feed's canonical URL.
+func (c cache) recoverFeedURL(reg *registry, id string) string {
+	dir := filepath.Join(c.dir, id)
+	var candidates []string
+	if data, err := ioutil.ReadFile(filepath.Join(dir, feedURLName)); err == nil {
+		candidates = append(candidates, string(data))
+	}
+	var meta feedMeta
+	if data, err := ioutil.ReadFile(filepath.Join(dir, feedMetaName)); err == nil && json.Unmarshal(data, &meta) == nil {
+		candidates = append(candidates, meta.URL)
+	}
+	for _, f := range reg.Feeds {
+		candidates = append(candidates, f.FeedURL)
+	}
+	for _, feedURL := range candidates {
+		if feedURL != "" && uniqueFeedID(feedURL) == id {
+			return feedURL
+		}
+	}
+	if x, err := c.loadIdentities(); err == nil {
+		for _, ident := range x.Feeds {
+			if ident.dir() == id {
+				return ident.URL
+			}
+		}
+	}
+	return ""
+}
+
+// isFeedID reports whether name is the name of a feed's cache directory.
+func isFeedID(name string) bool {
+	_, err := uuid.Parse(name)
+	return err == nil
+}
+
+// isCachedArchiveName reports whether name is the name of an archive in a
+// feed's cache directory, as opposed to a file stored next to it.
+func isCachedArchiveName(name string) bool {
+	switch name {
+	case markerName, feedURLName, feedDocumentName, feedMetaName:
+		return false
+	}
+	for _, suffix := range []string{cachedMetaSuffix, cachedSignatureSuffix, ".part", ".tmp"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCachedMetaName reports whether name is the name of the metadata of an
+// archive in a feed's cache directory.
+func isCachedMetaName(name string) bool {
+	switch name {
+	case feedDocumentName, feedMetaName:
+		return false
+	}
+	return strings.HasSuffix(name, cachedMetaSuffix) && !strings.HasSuffix(name, cachedFeedSuffix) &&
+		isCachedArchiveName(strings.TrimSuffix(name, cachedMetaSuffix))
+}
+
+// ErrNoCacheMetadata is returned when a cached archive cannot be verified
+// because nothing was recorded about it when it was downloaded.
+var ErrNoCacheMetadata = errors.New("no metadata was recorded for the archive")
+
+// CacheVerification is the result of verifying a cached archive.
+type CacheVerification struct {
+	// Entry is the archive that was verified.
+	Entry CacheEntry
+
+	// Method is how the archive was verified.
+	Method VerificationMethod
+
+	// Err is the reason the archive failed verification, or nil if it
+	// passed.
+	Err error
+}
+
+// VerifyCache verifies every archive in the cache again, without using the
+// network.
+//
+// Each archive is verified the way it was verified when it was downloaded.
+// Archives that were not verified when they were downloaded are checked
+// against the hash that was recorded then.
+func VerifyCache() ([]CacheVerification, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := cache.listEntries(reg)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CacheVerification, len(entries))
+	for i := range entries {
+		results[i].Entry = entries[i]
+		results[i].Method, results[i].Err = verifyCacheEntry(entries[i].Archive)
+	}
+	return results, nil
+}
+
+func verifyCacheEntry(cached *CachedArchive) (VerificationMethod, error) {
+	switch cached.VerificationMethod {
+	case GPGDetachedSignatureMethod, ChecksumMethod:
+		return cached.VerificationMethod, verifyCachedArchive(&cached.Feed, cached, cached.VerificationMethod)
+	}
+	if cached.ArchiveSHA256 == "" {
+		return DoNotVerifyMethod, ErrNoCacheMetadata
+	}
+	size, sum, err := hashFile(cached.File, ioutil.Discard)
+	if err != nil {
+		return ChecksumMethod, err
+	}
+	recorded := &Archive{ArchiveSHA256: cached.ArchiveSHA256, ArchiveSize: cached.ArchiveSize}
+	return ChecksumMethod, verifyChecksum(recorded, size, sum)
+}
+
+// PruneCacheOptions configures a call to PruneCache.
+type PruneCacheOptions struct {
+	// MaxSize is the size in bytes the cache is pruned to. Zero means no
+	// limit.
+	MaxSize int64
+
+	// MaxAge is how long an archive may go unused before it is pruned. Zero
+	// means no limit.
+	MaxAge time.Duration
+
+	// DryRun controls whether the archives are only reported and not removed.
+	DryRun bool
+}
+
+// PruneCache removes cached archives that were used least recently until the
+// cache fits in opts.MaxSize, and removes archives that were not used within
+// opts.MaxAge.
+//
+// Installed archives are never removed, so the cache may remain larger than
+// opts.MaxSize.
+//
+// PruneCache returns the archives that were removed and the number of bytes
+// that were freed.
+func PruneCache(opts PruneCacheOptions) ([]CacheEntry, int64, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, 0, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := cache.listEntries(reg)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	// An archive shared by several entries is only freed with the last one.
+	initial := CacheSize(entries)
+	total := initial
+	refs := map[string]int{}
+	for _, e := range entries {
+		refs[e.Archive.File]++
+	}
+	var pruned []CacheEntry
+	for _, e := range entries {
+		if e.Installed {
+			continue
+		}
+		tooBig := opts.MaxSize > 0 && total > opts.MaxSize
+		tooOld := opts.MaxAge > 0 && time.Since(e.LastUsed) > opts.MaxAge
+		if !tooBig && !tooOld {
+			continue
+		}
+		pruned = append(pruned, e)
+		total -= e.Size - e.fileSize
+		if refs[e.Archive.File]--; refs[e.Archive.File] == 0 {
+			total -= e.fileSize
+		}
+	}
+	if opts.DryRun {
+		return pruned, initial - total, nil
+	}
+	for _, e := range pruned {
+		cache.removeCacheEntry(reg, &e)
+	}
+	if _, err := cache.collectGarbage(reg); err != nil {
+		return pruned, initial - total, err
+	}
+	return pruned, initial - total, nil
+}
+
+// removeCacheEntry removes a cached archive.
+//
+// If it was the feed's last archive, the feed's cache directory is removed
+// too, unless the feed is installed there.
+func (c cache) removeCacheEntry(reg *registry, e *CacheEntry) {
+	removeCachedArchive(e.Archive.Path)
+	dir := filepath.Join(c.dir, e.FeedID)
+	marker := filepath.Join(dir, markerName)
+	if basename, err := ioutil.ReadFile(marker); err == nil && string(basename) == filepath.Base(e.Archive.Path) {
+		os.Remove(marker)
+	}
+	if remaining, err := c.listFeedEntries(reg, e.FeedID); err != nil || len(remaining) > 0 {
+		return
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			return
+		}
+	}
+	os.RemoveAll(dir)
+}
+
+// ClearCache removes every archive, feed document and partial download from
+// the cache.
+//
+// Installed feeds stay installed, but cannot be reinstalled offline until
+// their archives are downloaded again.
+func ClearCache() error {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return err
+	}
+	dirs, err := ioutil.ReadDir(cache.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !isFeedID(dir.Name()) {
+			continue
+		}
+		if err := cache.clearFeedDir(filepath.Join(cache.dir, dir.Name())); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(cache.dir, blobsDirName))
+}
+
+// removeUnusedFeedDir removes the feed cache directory dir if no installed
+// feed uses it, such as after a feed moved to a URL with another directory.
+func (c cache) removeUnusedFeedDir(reg *registry, dir string) {
+	for _, f := range reg.Feeds {
+		if filepath.Dir(f.ArchivePath) == dir {
+			return
+		}
+	}
+	if err := c.clearFeedDir(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", dir, err)
+	}
+}
+
+// clearFeedDir removes every file in a feed's cache directory, keeping the
+// directories archives are installed to.
+func (c cache) clearFeedDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var keep bool
+	for _, file := range files {
+		if file.IsDir() {
+			keep = true
+			continue
+		}
+		if file.Name() == feedURLName {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", file.Name(), err)
+		}
+	}
+	if !keep {
+		return os.RemoveAll(dir)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package zerogame
+
+import "fmt"
+
+// Channel is a release channel.
+//
+// Channels are ordered from most to least stable: stable, beta, nightly.
+// Installing from a channel selects the newest release that was published to
+// that channel or to a more stable one.
+type Channel string
+
+const (
+	// StableChannel is the default release channel.
+	StableChannel Channel = "stable"
+
+	// BetaChannel contains releases that are being tested before they are
+	// published to the stable channel.
+	BetaChannel Channel = "beta"
+
+	// NightlyChannel contains automated and experimental releases.
+	NightlyChannel Channel = "nightly"
+)
+
+var channelStability = map[Channel]int{
+	StableChannel:  0,
+	BetaChannel:    1,
+	NightlyChannel: 2,
+}
+
+// ParseChannel returns the Channel named s.
+//
+// The empty string is StableChannel.
+func ParseChannel(s string) (Channel, error) {
+	c := Channel(s)
+	if c == "" {
+		return StableChannel, nil
+	}
+	if _, ok := channelStability[c]; !ok {
+		return "", fmt.Errorf("invalid channel %q. must be one of: [stable beta nightly]", s)
+	}
+	return c, nil
+}
+
+// String returns the channel's name.
+func (c Channel) String() string {
+	if c == "" {
+		return string(StableChannel)
+	}
+	return string(c)
+}
+
+// includes reports whether releases published to other are available in c.
+func (c Channel) includes(other Channel) bool {
+	want, ok := channelStability[Channel(c.String())]
+	if !ok {
+		return c == other
+	}
+	got, ok := channelStability[Channel(other.String())]
+	return ok && got <= want
+}
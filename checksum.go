@@ -0,0 +1,84 @@
+package zerogame
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when an archive does not match the hash or
+// size in its feed.
+var ErrChecksumMismatch = errors.New("archive checksum mismatch")
+
+// ComputeArchiveChecksum downloads archiveURL and returns its hex-encoded
+// SHA-256 hash and size in bytes.
+func ComputeArchiveChecksum(ctx context.Context, archiveURL string) (string, int64, error) {
+	d := newDownloader(FetchOptions{}, nil)
+	size, sum, err := d.streamArchive(ctx, &Archive{ArchiveURL: archiveURL}, nil, ioutil.Discard)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(sum), size, nil
+}
+
+func (d *downloader) verifyFeedWithChecksum(ctx context.Context, feed *Feed, dst *partialFile) (*archiveDownload, error) {
+	if feed.ArchiveSHA256 == "" {
+		return nil, errors.New("feed has no archive_sha256")
+	}
+	size, sum, err := d.streamArchive(ctx, &feed.Archive, dst, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(&feed.Archive, size, sum); err != nil {
+		return nil, err
+	}
+	return &archiveDownload{method: ChecksumMethod, size: size, sha256: sum}, nil
+}
+
+// verifyChecksum checks the size and SHA-256 hash of a downloaded archive
+// against the hash and size in its feed, if set.
+func verifyChecksum(archive *Archive, size int64, sum []byte) error {
+	if archive.ArchiveSize > 0 && size != archive.ArchiveSize {
+		return fmt.Errorf("%w: archive is %d bytes, expected %d", ErrChecksumMismatch, size, archive.ArchiveSize)
+	}
+	if archive.ArchiveSHA256 == "" {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, "Verifying feed checksum...")
+	if got := hex.EncodeToString(sum); !strings.EqualFold(got, archive.ArchiveSHA256) {
+		return fmt.Errorf("%w: archive SHA-256 is %s, expected %s", ErrChecksumMismatch, got, archive.ArchiveSHA256)
+	}
+	fmt.Fprintln(os.Stderr, "Feed checksum verified")
+	return nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 hash of the file at filename.
+func fileSHA256(filename string) (string, error) {
+	_, sum, err := hashFile(filename, ioutil.Discard)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// hashFile copies the file at filename to w and returns its size and SHA-256
+// hash.
+func hashFile(filename string, w io.Writer) (int64, []byte, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer fd.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(hash, w), fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	return size, hash.Sum(nil), nil
+}
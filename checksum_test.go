@@ -0,0 +1,52 @@
+package zerogame
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyArchiveFileWithoutVerificationChecksArchive(t *testing.T) {
+	data := []byte("archive contents")
+	filename := filepath.Join(t.TempDir(), "game.zip")
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+
+	tests := []struct {
+		name    string
+		archive Archive
+		wantErr error
+	}{
+		{
+			name:    "matching hash and size",
+			archive: Archive{ArchiveSHA256: hex.EncodeToString(sum[:]), ArchiveSize: int64(len(data))},
+		},
+		{
+			name: "no hash or size",
+		},
+		{
+			name:    "wrong hash",
+			archive: Archive{ArchiveSHA256: hex.EncodeToString(make([]byte, sha256.Size))},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name:    "wrong size",
+			archive: Archive{ArchiveSize: int64(len(data)) + 1},
+			wantErr: ErrChecksumMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := &Feed{Release: Release{Archive: tt.archive}}
+			_, err := verifyArchiveFile(feed, filename, nil, DoNotVerifyMethod)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyArchiveFile() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/kendalharland/zerogame"
+	"github.com/maruel/subcommands"
+)
+
+func CmdBundle() *subcommands.Command {
+	return &subcommands.Command{
+		UsageLine: "bundle export feed_url|name... -o file.zgb | bundle import file.zgb",
+		ShortDesc: "copies cached archives to machines without internet",
+		LongDesc: "exports the cached archives of feeds to a bundle file, or imports a bundle into the cache " +
+			"so its feeds can be installed with install -offline. Imported archives are verified like downloaded ones",
+		CommandRun: func() subcommands.CommandRun {
+			c := &cmdBundle{}
+			c.Flags.StringVar(&c.output, "o", "", "export: The bundle file to write")
+			c.Flags.BoolVar(&c.allowUnsigned, "allow-unsigned", false, "import: Imports archives without a GPG signature, trusting whoever made the bundle")
+			return c
+		},
+	}
+}
+
+type cmdBundle struct {
+	subcommands.CommandRunBase
+
+	output        string
+	allowUnsigned bool
+}
+
+func (c *cmdBundle) Run(a subcommands.Application, args []string, _ subcommands.Env) int {
+	if len(args) == 0 {
+		log.Println(errors.New("expected export or import"))
+		return 1
+	}
+	rest, err := parseInterspersed(&c.Flags, args[1:])
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	if err := c.execute(context.Background(), args[0], rest); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cmdBundle) execute(ctx context.Context, action string, args []string) error {
+	switch action {
+	case "export":
+		return c.export(args)
+	case "import":
+		return c.importBundle(args)
+	}
+	return fmt.Errorf("unknown action %q: expected export or import", action)
+}
+
+func (c *cmdBundle) export(feeds []string) error {
+	if len(feeds) == 0 {
+		return errors.New("expected at least one feed URL or name")
+	}
+	if c.output == "" {
+		return errors.New("-o is required")
+	}
+	exported, err := zerogame.ExportBundle(c.output, feeds)
+	if err != nil {
+		return err
+	}
+	for _, a := range exported {
+		fmt.Fprintf(os.Stdout, "Exported %s %s (%s)\n", a.Name, a.Version, a.FeedURL)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", c.output)
+	return nil
+}
+
+func (c *cmdBundle) importBundle(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one bundle file")
+	}
+	imported, err := zerogame.ImportBundle(args[0], zerogame.ImportBundleOptions{
+		VerificationMethod: zerogame.AutoSelectMethod,
+		AllowUnsigned:      c.allowUnsigned,
+	})
+	for _, a := range imported {
+		if a.Err != nil {
+			fmt.Fprintf(os.Stdout, "[fail] %s %s (%s): %v\n", a.Name, a.Version, a.FeedURL, a.Err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "[ok]   %s %s (%s)\n", a.Name, a.Version, a.FeedURL)
+	}
+	return err
+}
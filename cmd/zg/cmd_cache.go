@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kendalharland/zerogame"
+	"github.com/maruel/subcommands"
+)
+
+func CmdCache() *subcommands.Command {
+	return &subcommands.Command{
+		UsageLine: "cache list|verify|prune|gc|clear",
+		ShortDesc: "manages cached archives",
+		LongDesc: "lists the cached archives, verifies them again, prunes the least recently used ones, " +
+			"removes stored archives no feed refers to or clears the cache. Installed archives are never pruned",
+		CommandRun: func() subcommands.CommandRun {
+			c := &cmdCache{}
+			c.Flags.Var(&c.maxSize, "max-size", "prune: Removes archives until the cache is this size, e.g. 10GB")
+			c.Flags.Var(&c.maxAge, "max-age", "prune: Removes archives not used for this long, e.g. 30d or 12h")
+			c.Flags.BoolVar(&c.dryRun, "dry-run", false, "prune: Only reports the archives that would be removed")
+			return c
+		},
+	}
+}
+
+type cmdCache struct {
+	subcommands.CommandRunBase
+
+	maxSize byteSizeFlag
+	maxAge  ageFlag
+	dryRun  bool
+}
+
+func (c *cmdCache) Run(a subcommands.Application, args []string, _ subcommands.Env) int {
+	if len(args) == 0 {
+		log.Println(errors.New("expected one of list, verify, prune, gc or clear"))
+		return 1
+	}
+	rest, err := parseInterspersed(&c.Flags, args[1:])
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	if len(rest) > 0 {
+		log.Println(fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " ")))
+		return 1
+	}
+	if err := c.execute(context.Background(), args[0]); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cmdCache) execute(ctx context.Context, action string) error {
+	switch action {
+	case "list":
+		return c.list()
+	case "verify":
+		return c.verify()
+	case "prune":
+		return c.prune()
+	case "gc":
+		freed, err := zerogame.GarbageCollectCache()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Freed %s\n", formatBytes(freed))
+		return nil
+	case "clear":
+		if err := zerogame.ClearCache(); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Cleared the cache")
+		return nil
+	}
+	return fmt.Errorf("unknown action %q: expected one of list, verify, prune, gc or clear", action)
+}
+
+func (c *cmdCache) list() error {
+	entries, err := zerogame.ListCache()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "The cache is empty")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tSIZE\tLAST USED\tINSTALLED\tFEED URL")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, orUnknown(e.Version), formatBytes(e.Size),
+			e.LastUsed.Local().Format(time.RFC822), yesNo(e.Installed), orUnknown(e.FeedURL))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%d archives, %s\n", len(entries), formatBytes(zerogame.CacheSize(entries)))
+	return nil
+}
+
+func (c *cmdCache) verify() error {
+	results, err := zerogame.VerifyCache()
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "The cache is empty")
+		return nil
+	}
+	var failed bool
+	for _, r := range results {
+		name := r.Entry.Name
+		if r.Entry.Version != "" {
+			name += " " + r.Entry.Version
+		}
+		if errors.Is(r.Err, zerogame.ErrNoCacheMetadata) {
+			fmt.Fprintf(os.Stdout, "[skip] %s (%s): %v\n", name, r.Entry.Archive.Path, r.Err)
+			continue
+		}
+		if r.Err != nil {
+			failed = true
+			fmt.Fprintf(os.Stdout, "[fail] %s (%s): %v\n", name, r.Entry.Archive.Path, r.Err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "[ok]   %s: %s\n", name, verificationName(r.Method))
+	}
+	if failed {
+		return errors.New("some cached archives failed verification")
+	}
+	return nil
+}
+
+func (c *cmdCache) prune() error {
+	if c.maxSize == 0 && c.maxAge == 0 {
+		return errors.New("prune needs -max-size or -max-age")
+	}
+	pruned, freed, err := zerogame.PruneCache(zerogame.PruneCacheOptions{
+		MaxSize: int64(c.maxSize),
+		MaxAge:  time.Duration(c.maxAge),
+		DryRun:  c.dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if c.dryRun {
+		verb = "Would remove"
+	}
+	for _, e := range pruned {
+		fmt.Fprintf(os.Stdout, "%s %s %s (%s)\n", verb, e.Name, orUnknown(e.Version), formatBytes(e.Size))
+	}
+	fmt.Fprintf(os.Stderr, "%s %d archives, %s\n", verb, len(pruned), formatBytes(freed))
+	return nil
+}
+
+// parseInterspersed parses flags that follow the action of a command, e.g.
+// "cache prune -max-size 10GB", and returns the remaining arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// byteSizeFlag is a flag.Value for a size in bytes with an optional unit,
+// e.g. 500MB or 10GB.
+type byteSizeFlag int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func (f *byteSizeFlag) String() string {
+	if *f == 0 {
+		return ""
+	}
+	return formatBytes(int64(*f))
+}
+
+func (f *byteSizeFlag) Set(value string) error {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*f = byteSizeFlag(n * float64(unit))
+	return nil
+}
+
+// ageFlag is a flag.Value for a time.Duration that also accepts a number of
+// days, e.g. 30d.
+type ageFlag time.Duration
+
+func (f *ageFlag) String() string {
+	if *f == 0 {
+		return ""
+	}
+	return time.Duration(*f).String()
+}
+
+func (f *ageFlag) Set(value string) error {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid age %q", value)
+		}
+		*f = ageFlag(n * float64(24*time.Hour))
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid age %q", value)
+	}
+	*f = ageFlag(d)
+	return nil
+}
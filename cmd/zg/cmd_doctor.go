@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kendalharland/zerogame"
+	"github.com/maruel/subcommands"
+)
+
+func CmdDoctor() *subcommands.Command {
+	return &subcommands.Command{
+		UsageLine: "doctor [url...]",
+		ShortDesc: "checks the zerogame configuration",
+		LongDesc: "checks the configuration file, proxy, CA bundle and client certificate, " +
+			"then fetches each URL, or the feed of every installed archive if no URL is given",
+		CommandRun: func() subcommands.CommandRun {
+			c := &cmdDoctor{}
+			c.fetch.register(&c.Flags)
+			return c
+		},
+	}
+}
+
+type cmdDoctor struct {
+	subcommands.CommandRunBase
+
+	fetch  fetchFlags
+	failed bool
+}
+
+func (c *cmdDoctor) Run(a subcommands.Application, args []string, _ subcommands.Env) int {
+	ctx, cancel := c.fetch.context()
+	defer cancel()
+	if err := c.execute(ctx, args); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cmdDoctor) execute(ctx context.Context, urls []string) error {
+	configPath, err := zerogame.ConfigPath()
+	if err != nil {
+		return err
+	}
+	config, err := zerogame.LoadConfig()
+	if err != nil {
+		c.fail("Configuration", err)
+		return errors.New("some checks failed")
+	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		c.ok("Configuration", "%s does not exist, using the defaults", configPath)
+	} else {
+		c.ok("Configuration", "%s", configPath)
+	}
+
+	c.checkProxy(&config.Network)
+	c.checkCABundle(&config.Network)
+	c.checkClientCert(&config.Network)
+	if _, err := zerogame.NewHTTPClient(config.Network); err != nil {
+		c.fail("HTTP client", err)
+	}
+
+	if len(urls) == 0 {
+		feeds, err := zerogame.ListInstalledFeeds()
+		if err != nil {
+			return err
+		}
+		for _, f := range feeds {
+			urls = append(urls, f.FeedURL)
+		}
+	}
+	for _, u := range urls {
+		if err := zerogame.CheckURL(ctx, u, c.fetch.options()); err != nil {
+			c.fail(u, err)
+		} else {
+			c.ok(u, "reachable")
+		}
+	}
+
+	if c.failed {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
+
+func (c *cmdDoctor) ok(check, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stdout, "[ok]   %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (c *cmdDoctor) fail(check string, err error) {
+	c.failed = true
+	fmt.Fprintf(os.Stdout, "[fail] %s: %v\n", check, err)
+}
+
+func (c *cmdDoctor) checkProxy(config *zerogame.NetworkConfig) {
+	proxy, err := config.ProxyFunc()
+	if err != nil {
+		c.fail("Proxy", err)
+		return
+	}
+	proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "example.com"}})
+	if err != nil {
+		c.fail("Proxy", err)
+		return
+	}
+	if proxyURL == nil {
+		c.ok("Proxy", "not used")
+		return
+	}
+	host := proxyURL.Host
+	if proxyURL.Port() == "" {
+		host = net.JoinHostPort(proxyURL.Hostname(), defaultProxyPort(proxyURL.Scheme))
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		c.fail("Proxy", fmt.Errorf("cannot connect to %s: %w", proxyURL.Redacted(), err))
+		return
+	}
+	conn.Close()
+	c.ok("Proxy", "%s accepts connections", proxyURL.Redacted())
+}
+
+// defaultProxyPort returns the port of a proxy URL with the given scheme
+// that does not have one.
+func defaultProxyPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "https":
+		return "443"
+	case "socks5", "socks5h":
+		return "1080"
+	}
+	return "80"
+}
+
+func (c *cmdDoctor) checkCABundle(config *zerogame.NetworkConfig) {
+	if config.CABundle == "" {
+		c.ok("CA bundle", "not used")
+		return
+	}
+	pem, err := ioutil.ReadFile(config.CABundle)
+	if err != nil {
+		c.fail("CA bundle", err)
+		return
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		c.fail("CA bundle", fmt.Errorf("%s has no PEM encoded certificates", config.CABundle))
+		return
+	}
+	c.ok("CA bundle", "%s", config.CABundle)
+}
+
+func (c *cmdDoctor) checkClientCert(config *zerogame.NetworkConfig) {
+	if config.ClientCert == "" && config.ClientKey == "" {
+		c.ok("Client certificate", "not used")
+		return
+	}
+	if config.ClientCert == "" || config.ClientKey == "" {
+		c.fail("Client certificate", errors.New("both a client certificate and a client key are needed"))
+		return
+	}
+	pair, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+	if err != nil {
+		c.fail("Client certificate", err)
+		return
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		c.fail("Client certificate", err)
+		return
+	}
+	if time.Now().After(cert.NotAfter) {
+		c.fail("Client certificate", fmt.Errorf("%s expired on %s", cert.Subject, cert.NotAfter.Format(time.RFC822)))
+		return
+	}
+	c.ok("Client certificate", "%s, expires on %s", cert.Subject, cert.NotAfter.Format(time.RFC822))
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/kendalharland/zerogame"
 	"github.com/maruel/subcommands"
@@ -24,6 +27,8 @@ func CmdFeed() *subcommands.Command {
 		CommandRun: func() subcommands.CommandRun {
 			c := &cmdFeed{}
 			c.Flags.StringVar(&c.feedPath, "o", defaultFeedPath, "where to write the output feed")
+			c.Flags.Var(&c.archives, "archive", "a platform-specific archive as GOOS/GOARCH=archive_url. May be repeated")
+			c.Flags.StringVar(&c.feedURL, "url", "", "the URL the feed will be published at. Defaults to the output file")
 			return c
 		},
 	}
@@ -33,15 +38,44 @@ type cmdFeed struct {
 	subcommands.CommandRunBase
 
 	feedPath string
+	feedURL  string
+	archives archiveFlags
 	feed     zerogame.Feed
 }
 
+// archiveFlags collects repeated -archive GOOS/GOARCH=archive_url flags.
+type archiveFlags []zerogame.Archive
+
+func (f *archiveFlags) String() string {
+	var values []string
+	for _, a := range *f {
+		values = append(values, a.Platform+"="+a.ArchiveURL)
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *archiveFlags) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i < 0 {
+		return errors.New("expected GOOS/GOARCH=archive_url")
+	}
+	platform, archiveURL := value[:i], value[i+1:]
+	if err := zerogame.ValidatePlatform(platform); err != nil {
+		return err
+	}
+	if err := validateURL(archiveURL); err != nil {
+		return err
+	}
+	*f = append(*f, zerogame.Archive{Platform: platform, ArchiveURL: archiveURL, ArchiveType: "zip"})
+	return nil
+}
+
 func (c *cmdFeed) Run(a subcommands.Application, _ []string, _ subcommands.Env) int {
 	if err := c.execute(context.Background()); err != nil {
 		log.Println(err)
-		return 0
+		return 1
 	}
-	return 1
+	return 0
 }
 
 func (c *cmdFeed) execute(ctx context.Context) error {
@@ -51,7 +85,7 @@ func (c *cmdFeed) execute(ctx context.Context) error {
 		stdout: os.Stdout,
 	}
 
-	if err := c.getFeedProperties(&p, &c.feed); err != nil {
+	if err := c.getFeedProperties(ctx, &p, &c.feed); err != nil {
 		return err
 	}
 
@@ -63,6 +97,10 @@ func (c *cmdFeed) execute(ctx context.Context) error {
 		c.feedPath = fp
 	}
 
+	if err := c.offerRelativeURLs(&p); err != nil {
+		return err
+	}
+
 	feedBytes, err := json.MarshalIndent(c.feed, "", "  ")
 	if err != nil {
 		return err
@@ -76,30 +114,184 @@ func (c *cmdFeed) execute(ctx context.Context) error {
 	return nil
 }
 
-func (c *cmdFeed) getFeedProperties(p *prompt, f *zerogame.Feed) error {
+func (c *cmdFeed) getFeedProperties(ctx context.Context, p *prompt, f *zerogame.Feed) error {
 	name, err := p.ReadNonEmptyString("Enter the feed name: ")
 	if err != nil {
 		return err
 	}
 	f.Name = name
 
-	version, err := p.ReadNonEmptyString("Enter the feed version: ")
+	version, err := p.ReadVersion("Enter the feed version: ")
 	if err != nil {
 		return err
 	}
 	f.Version = version
 
-	archiveURL, err := p.ReadURL("Enter the feed archive URL: ")
+	if len(c.archives) > 0 {
+		for _, a := range c.archives {
+			gpgSignatureURL, err := p.ReadString(fmt.Sprintf("Enter the GPG signature URL for %s (optional): ", a.Platform))
+			if err != nil {
+				return err
+			}
+			a.GPGSignatureURL = gpgSignatureURL
+			if err := readMirrors(p, &a); err != nil {
+				return err
+			}
+			warnIfNotDirect(a.ArchiveURL)
+			warnIfNotDirect(a.GPGSignatureURL)
+			if err := computeChecksum(ctx, &a); err != nil {
+				return err
+			}
+			f.Archives = append(f.Archives, a)
+		}
+		return nil
+	}
+
+	platform, err := p.ReadPlatform("Enter the archive platform as GOOS/GOARCH, e.g. linux/amd64 or windows/* (leave empty for all platforms): ")
 	if err != nil {
 		return err
 	}
-	f.ArchiveURL = archiveURL
-	f.ArchiveType = "zip"
+	if platform == "" {
+		return c.getArchiveProperties(ctx, p, &f.Archive, "Enter the feed archive URL: ")
+	}
+	for platform != "" {
+		a := zerogame.Archive{Platform: platform}
+		if err := c.getArchiveProperties(ctx, p, &a, fmt.Sprintf("Enter the archive URL for %s: ", platform)); err != nil {
+			return err
+		}
+		f.Archives = append(f.Archives, a)
+		platform, err = p.ReadPlatform("Enter another archive platform (leave empty when done): ")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cmdFeed) getArchiveProperties(ctx context.Context, p *prompt, a *zerogame.Archive, urlPrompt string) error {
+	archiveURL, err := p.ReadURL(urlPrompt)
+	if err != nil {
+		return err
+	}
+	a.ArchiveURL = archiveURL
+	a.ArchiveType = "zip"
+	warnIfNotDirect(a.ArchiveURL)
 
 	gpgSignatureURL, err := p.ReadString("Enter the GPG signature URL (optional): ")
 	if err != nil {
 		return err
 	}
-	f.GPGSignatureURL = gpgSignatureURL
+	a.GPGSignatureURL = gpgSignatureURL
+	warnIfNotDirect(a.GPGSignatureURL)
+	if err := readMirrors(p, a); err != nil {
+		return err
+	}
+	return computeChecksum(ctx, a)
+}
+
+// readMirrors asks for other URLs that serve the same archive and signature.
+func readMirrors(p *prompt, a *zerogame.Archive) error {
+	for {
+		mirror, err := p.ReadOptionalURL("Enter a mirror URL for the archive (leave empty when done): ")
+		if err != nil || mirror == "" {
+			if err != nil || a.GPGSignatureURL == "" {
+				return err
+			}
+			break
+		}
+		warnIfNotDirect(mirror)
+		a.Mirrors = append(a.Mirrors, mirror)
+	}
+	for {
+		mirror, err := p.ReadOptionalURL("Enter a mirror URL for the GPG signature (leave empty when done): ")
+		if err != nil || mirror == "" {
+			return err
+		}
+		warnIfNotDirect(mirror)
+		a.GPGSignatureMirrors = append(a.GPGSignatureMirrors, mirror)
+	}
+}
+
+// offerRelativeURLs offers to replace the URLs of files published next to the
+// feed with URLs relative to the feed, so the folder can be moved without
+// editing the feed.
+func (c *cmdFeed) offerRelativeURLs(p *prompt) error {
+	feedURL := c.feedURL
+	if feedURL == "" {
+		abs, err := filepath.Abs(c.feedPath)
+		if err != nil {
+			return err
+		}
+		feedURL = "file://" + filepath.ToSlash(abs)
+	}
+	dir := feedURL
+	if i := strings.IndexAny(dir, "?#"); i >= 0 {
+		dir = dir[:i]
+	}
+	dir = dir[:strings.LastIndex(dir, "/")+1]
+
+	var urls []*string
+	forEachURL(&c.feed, func(u *string) {
+		if rel := strings.TrimPrefix(*u, dir); rel != *u && rel != "" {
+			urls = append(urls, u)
+		}
+	})
+	if len(urls) == 0 {
+		return nil
+	}
+	answer, err := p.ReadOneOf(fmt.Sprintf("Some URLs point next to the feed in %s. Write them relative to the feed? (yes/no): ", dir), "yes", "no")
+	if err != nil || answer == "no" {
+		return err
+	}
+	for _, u := range urls {
+		*u = strings.TrimPrefix(*u, dir)
+	}
+	return nil
+}
+
+// forEachURL calls fn with every archive, signature and mirror URL of f.
+func forEachURL(f *zerogame.Feed, fn func(u *string)) {
+	archives := []*zerogame.Archive{&f.Archive}
+	for i := range f.Archives {
+		archives = append(archives, &f.Archives[i])
+	}
+	for _, a := range archives {
+		for _, u := range []*string{&a.ArchiveURL, &a.GPGSignatureURL} {
+			if *u != "" {
+				fn(u)
+			}
+		}
+		for i := range a.Mirrors {
+			fn(&a.Mirrors[i])
+		}
+		for i := range a.GPGSignatureMirrors {
+			fn(&a.GPGSignatureMirrors[i])
+		}
+	}
+}
+
+// warnIfNotDirect warns when u is a share link that opens a preview page
+// instead of downloading the file.
+func warnIfNotDirect(u string) {
+	if u == "" {
+		return
+	}
+	if direct := zerogame.RewriteURL(u); direct != u {
+		fmt.Fprintf(os.Stderr, "Warning: %s does not download the file directly. zerogame will download it from %s instead\n", u, direct)
+	}
+}
+
+func computeChecksum(ctx context.Context, a *zerogame.Archive) error {
+	fmt.Fprintf(os.Stderr, "Computing the checksum of %s...\n", a.ArchiveURL)
+	sha256, size, err := zerogame.ComputeArchiveChecksum(ctx, a.ArchiveURL)
+	var htmlErr *zerogame.HTMLResponseError
+	if errors.As(err, &htmlErr) {
+		return fmt.Errorf("%s does not download the file directly. it returned an HTML page, such as a preview or login page", a.ArchiveURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", a.ArchiveURL, err)
+	}
+	a.ArchiveSHA256 = sha256
+	a.ArchiveSize = size
 	return nil
 }
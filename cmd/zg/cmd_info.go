@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kendalharland/zerogame"
+	"github.com/maruel/subcommands"
+)
+
+func CmdInfo() *subcommands.Command {
+	return &subcommands.Command{
+		UsageLine:  "info feed_url|name",
+		ShortDesc:  "describes an installed or cached feed",
+		LongDesc:   "describes the installed version and the cached archive of a feed",
+		CommandRun: func() subcommands.CommandRun { return &cmdInfo{} },
+	}
+}
+
+type cmdInfo struct {
+	subcommands.CommandRunBase
+}
+
+func (c *cmdInfo) Run(a subcommands.Application, args []string, _ subcommands.Env) int {
+	if len(args) != 1 {
+		log.Println(errors.New("expected exactly one feed URL or name"))
+		return 1
+	}
+	if err := c.execute(context.Background(), args[0]); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cmdInfo) execute(ctx context.Context, feedURLOrName string) error {
+	info, err := zerogame.GetFeedInfo(feedURLOrName)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", name, value)
+		}
+	}
+	field("Feed URL", info.FeedURL)
+	if f := info.Installed; f != nil && f.FeedID != "" {
+		field("Feed ID", f.FeedID)
+	} else if a := info.Archive; a != nil {
+		field("Feed ID", a.Feed.ID)
+	}
+	if !info.FetchedAt.IsZero() {
+		field("Last fetched", info.FetchedAt.Local().Format(time.RFC822))
+	}
+
+	if f := info.Installed; f != nil {
+		field("Name", f.Name)
+		field("Installed version", f.Version)
+		field("Channel", f.Channel.String())
+		if f.Pinned {
+			field("Pinned", "yes")
+		}
+		field("Install path", f.InstallDir)
+		if !f.InstalledAt.IsZero() {
+			field("Installed", f.InstalledAt.Local().Format(time.RFC822))
+		}
+	} else {
+		field("Installed version", "not installed")
+	}
+
+	if a := info.Archive; a != nil {
+		field("Cached archive", a.Path)
+		if a.File != a.Path {
+			field("Stored at", a.File)
+		}
+		field("Cached version", a.Feed.Version)
+		field("Archive URL", a.Feed.ArchiveURL)
+		field("Platform", a.Feed.Platform)
+		field("Signature URL", a.Feed.GPGSignatureURL)
+		field("SHA-256", a.ArchiveSHA256)
+		if a.ArchiveSize > 0 {
+			field("Size", formatBytes(a.ArchiveSize))
+		}
+		field("Verified with", verificationName(a.VerificationMethod))
+		if !a.DownloadedAt.IsZero() {
+			field("Downloaded", a.DownloadedAt.Local().Format(time.RFC822))
+		}
+		field("Cached feed", a.FeedDocumentPath)
+		field("Cached signature", a.SignaturePath)
+	}
+	return w.Flush()
+}
+
+// verificationName describes how an archive was verified.
+func verificationName(method zerogame.VerificationMethod) string {
+	switch method {
+	case zerogame.DoNotVerifyMethod:
+		return "nothing"
+	case zerogame.GPGDetachedSignatureMethod:
+		return "GPG signature"
+	case zerogame.ChecksumMethod:
+		return "SHA-256 checksum"
+	}
+	return ""
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/kendalharland/zerogame"
 	"github.com/maruel/subcommands"
@@ -11,13 +13,18 @@ import (
 
 func CmdInstall() *subcommands.Command {
 	return &subcommands.Command{
-		UsageLine: "install feed_url",
+		UsageLine: "install feed_url[@version]",
 		ShortDesc: "installs an archive from a feed URL",
-		LongDesc:  "installs an archive from a feed URL",
+		LongDesc:  "installs an archive from a feed URL. Pass -version, or append @version to the URL's path, to install a specific version.",
 		CommandRun: func() subcommands.CommandRun {
 			c := &cmdInstall{}
-			c.Flags.BoolVar(&c.disableVerification, "noverify", false, "Disables Feed verification")
+			c.Flags.BoolVar(&c.disableVerification, "noverify", false, "Disables Feed signature verification. The archive checksum is still checked")
 			c.Flags.BoolVar(&c.disableCache, "nocache", false, "Forces downloading the feed even if it exists locally")
+			c.Flags.BoolVar(&c.allowDowngrade, "allow-downgrade", false, "Allows replacing an installed feed with an older version")
+			c.Flags.BoolVar(&c.offline, "offline", false, "Installs from the cache only, without using the network")
+			c.fetch.register(&c.Flags)
+			c.Flags.StringVar(&c.channel, "channel", "", "Installs the newest release from this channel (stable, beta or nightly)")
+			c.Flags.StringVar(&c.version, "version", "", "Installs this version instead of the newest release")
 			return c
 		},
 	}
@@ -28,10 +35,17 @@ type cmdInstall struct {
 
 	disableVerification bool
 	disableCache        bool
+	allowDowngrade      bool
+	offline             bool
+	fetch               fetchFlags
+	channel             string
+	version             string
 }
 
 func (c *cmdInstall) Run(a subcommands.Application, _ []string, _ subcommands.Env) int {
-	if err := c.execute(context.Background()); err != nil {
+	ctx, cancel := c.fetch.context()
+	defer cancel()
+	if err := c.execute(ctx); err != nil {
 		log.Println(err)
 		return 1
 	}
@@ -42,12 +56,54 @@ func (c *cmdInstall) execute(ctx context.Context) error {
 	if c.Flags.NArg() != 1 {
 		return errors.New("expected one argument")
 	}
+	feedURL, version := splitFeedVersion(c.Flags.Arg(0))
+	if c.version != "" {
+		if version != "" {
+			return errors.New("a version and -version cannot both be given")
+		}
+		version = c.version
+	}
 	opts := zerogame.InstallFeedOptions{
 		UseCache:           !c.disableCache,
 		VerificationMethod: zerogame.AutoSelectMethod,
+		AllowDowngrade:     c.allowDowngrade,
+		Progress:           (&progressBar{w: os.Stderr}).Update,
+		FetchOptions:       c.fetch.options(),
+		Version:            version,
+		Offline:            c.offline,
 	}
 	if c.disableVerification {
 		opts.VerificationMethod = zerogame.DoNotVerifyMethod
 	}
-	return zerogame.InstallFeed(ctx, c.Flags.Arg(0), opts)
+	if c.channel != "" {
+		channel, err := zerogame.ParseChannel(c.channel)
+		if err != nil {
+			return err
+		}
+		opts.Channel = channel
+	}
+	if opts.Version != "" && opts.Channel != "" {
+		return errors.New("a version and -channel cannot both be given")
+	}
+	if c.offline && c.disableCache {
+		return errors.New("-offline and -nocache cannot both be given")
+	}
+	return zerogame.InstallFeed(ctx, feedURL, opts)
+}
+
+// splitFeedVersion splits feed_url@version into the feed URL and version.
+//
+// Only an @ after the last path separator of the URL's path starts the
+// version, so user info is preserved. The query and fragment, which may
+// contain an @ themselves, follow the version: feed.json@1.0?dl=1.
+func splitFeedVersion(arg string) (feedURL, version string) {
+	path, rest := arg, ""
+	if i := strings.IndexAny(arg, "?#"); i >= 0 {
+		path, rest = arg[:i], arg[i:]
+	}
+	i := strings.LastIndex(path, "@")
+	if i < 0 || i < strings.LastIndex(path, "/") {
+		return arg, ""
+	}
+	return path[:i] + rest, path[i+1:]
 }
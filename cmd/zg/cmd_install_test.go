@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestSplitFeedVersion(t *testing.T) {
+	tests := []struct {
+		arg, feedURL, version string
+	}{
+		{"https://example.com/feed.json", "https://example.com/feed.json", ""},
+		{"https://example.com/feed.json@1.0", "https://example.com/feed.json", "1.0"},
+		{"https://user@example.com/feed.json", "https://user@example.com/feed.json", ""},
+		{"https://user@example.com/feed.json@1.0", "https://user@example.com/feed.json", "1.0"},
+		{"https://example.com/feed.json?sig=a@b", "https://example.com/feed.json?sig=a@b", ""},
+		{"https://example.com/feed.json@1.0?dl=1", "https://example.com/feed.json?dl=1", "1.0"},
+		{"https://example.com/feed.json#a@b", "https://example.com/feed.json#a@b", ""},
+	}
+	for _, tt := range tests {
+		feedURL, version := splitFeedVersion(tt.arg)
+		if feedURL != tt.feedURL || version != tt.version {
+			t.Errorf("splitFeedVersion(%q) = %q, %q, want %q, %q", tt.arg, feedURL, version, tt.feedURL, tt.version)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kendalharland/zerogame"
+	"github.com/maruel/subcommands"
+)
+
+func CmdList() *subcommands.Command {
+	return &subcommands.Command{
+		UsageLine:  "list",
+		ShortDesc:  "lists installed archives",
+		LongDesc:   "lists the archives installed on this machine",
+		CommandRun: func() subcommands.CommandRun { return &cmdList{} },
+	}
+}
+
+type cmdList struct {
+	subcommands.CommandRunBase
+}
+
+func (c *cmdList) Run(a subcommands.Application, _ []string, _ subcommands.Env) int {
+	if err := c.execute(context.Background()); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cmdList) execute(ctx context.Context) error {
+	feeds, err := zerogame.ListInstalledFeeds()
+	if err != nil {
+		return err
+	}
+	if len(feeds) == 0 {
+		fmt.Fprintln(os.Stderr, "No feeds are installed")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tFEED URL\tINSTALL PATH\tINSTALLED")
+	for _, f := range feeds {
+		installedAt := "unknown"
+		if !f.InstalledAt.IsZero() {
+			installedAt = f.InstalledAt.Local().Format(time.RFC822)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Name, f.Version, f.FeedURL, f.InstallDir, installedAt)
+	}
+	return w.Flush()
+}
@@ -5,14 +5,15 @@ import (
 	"errors"
 	"log"
 
+	"github.com/kendalharland/zerogame"
 	"github.com/maruel/subcommands"
 )
 
 func CmdRun() *subcommands.Command {
 	return &subcommands.Command{
-		UsageLine:  "run",
+		UsageLine:  "run feed_url|name [-- args...]",
 		ShortDesc:  "runs an archive from a feed URL",
-		LongDesc:   "runs an archive from a feed URL",
+		LongDesc:   "runs an archive from a feed URL. Arguments after -- are passed to the game.",
 		CommandRun: func() subcommands.CommandRun { return &cmdRun{} },
 	}
 }
@@ -22,13 +23,21 @@ type cmdRun struct {
 }
 
 func (c *cmdRun) Run(a subcommands.Application, _ []string, _ subcommands.Env) int {
-	if err := c.execute(context.Background()); err != nil {
+	code, err := c.execute(context.Background())
+	if err != nil {
 		log.Println(err)
-		return 0
+		return 1
 	}
-	return 1
+	return code
 }
 
-func (c *cmdRun) execute(ctx context.Context) error {
-	return errors.New("unimplemented")
+func (c *cmdRun) execute(ctx context.Context) (int, error) {
+	if c.Flags.NArg() < 1 {
+		return 0, errors.New("expected at least one argument")
+	}
+	args := c.Flags.Args()[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	return zerogame.RunFeed(ctx, c.Flags.Arg(0), args, zerogame.RunFeedOptions{})
 }
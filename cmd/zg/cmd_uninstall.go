@@ -5,30 +5,43 @@ import (
 	"errors"
 	"log"
 
+	"github.com/kendalharland/zerogame"
 	"github.com/maruel/subcommands"
 )
 
 func CmdUninstall() *subcommands.Command {
 	return &subcommands.Command{
-		UsageLine:  "uninstall",
-		ShortDesc:  "Uninstalls an archive",
-		LongDesc:   "Uninstalls an archive",
-		CommandRun: func() subcommands.CommandRun { return &cmdUninstall{} },
+		UsageLine: "uninstall feed_url|name",
+		ShortDesc: "Uninstalls an archive",
+		LongDesc:  "Uninstalls an archive",
+		CommandRun: func() subcommands.CommandRun {
+			c := &cmdUninstall{}
+			c.Flags.BoolVar(&c.keepCache, "keepcache", false, "Keeps the feed's cached archive after uninstalling")
+			return c
+		},
 	}
 }
 
 type cmdUninstall struct {
 	subcommands.CommandRunBase
+
+	keepCache bool
 }
 
 func (c *cmdUninstall) Run(a subcommands.Application, _ []string, _ subcommands.Env) int {
 	if err := c.execute(context.Background()); err != nil {
 		log.Println(err)
-		return 0
+		return 1
 	}
-	return 1
+	return 0
 }
 
 func (c *cmdUninstall) execute(ctx context.Context) error {
-	return errors.New("unimplemented")
+	if c.Flags.NArg() != 1 {
+		return errors.New("expected one argument")
+	}
+	opts := zerogame.UninstallFeedOptions{
+		KeepCache: c.keepCache,
+	}
+	return zerogame.UninstallFeed(ctx, c.Flags.Arg(0), opts)
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/kendalharland/zerogame"
+	"github.com/maruel/subcommands"
+)
+
+func CmdUpdate() *subcommands.Command {
+	return &subcommands.Command{
+		UsageLine: "update",
+		ShortDesc: "updates installed archives",
+		LongDesc:  "refetches every installed feed and upgrades the archives whose version changed",
+		CommandRun: func() subcommands.CommandRun {
+			c := &cmdUpdate{}
+			c.Flags.BoolVar(&c.check, "check", false, "Only reports available updates")
+			c.Flags.BoolVar(&c.disableVerification, "noverify", false, "Disables Feed signature verification. The archive checksum is still checked")
+			c.Flags.BoolVar(&c.allowDowngrade, "allow-downgrade", false, "Allows replacing an installed feed with an older version")
+			c.fetch.register(&c.Flags)
+			return c
+		},
+	}
+}
+
+type cmdUpdate struct {
+	subcommands.CommandRunBase
+
+	check               bool
+	disableVerification bool
+	allowDowngrade      bool
+	fetch               fetchFlags
+}
+
+func (c *cmdUpdate) Run(a subcommands.Application, _ []string, _ subcommands.Env) int {
+	ctx, cancel := c.fetch.context()
+	defer cancel()
+	if err := c.execute(ctx); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cmdUpdate) execute(ctx context.Context) error {
+	opts := zerogame.UpdateFeedsOptions{
+		CheckOnly:          c.check,
+		VerificationMethod: zerogame.AutoSelectMethod,
+		AllowDowngrade:     c.allowDowngrade,
+		Progress:           (&progressBar{w: os.Stderr}).Update,
+		FetchOptions:       c.fetch.options(),
+	}
+	if c.disableVerification {
+		opts.VerificationMethod = zerogame.DoNotVerifyMethod
+	}
+	updates, err := zerogame.UpdateFeeds(ctx, opts)
+	if c.check {
+		for _, u := range updates {
+			fmt.Fprintf(os.Stdout, "%s: %s -> %s (%s)\n", u.Name, u.InstalledVersion, u.AvailableVersion, u.FeedURL)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		fmt.Fprintln(os.Stderr, "All feeds are up to date")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/kendalharland/zerogame"
+)
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultRetries        = 3
+)
+
+// fetchFlags are the flags shared by commands that download feeds.
+type fetchFlags struct {
+	timeout        time.Duration
+	requestTimeout time.Duration
+	retries        int
+	mirrorOrder    mirrorOrderFlag
+}
+
+// mirrorOrderFlag is a flag.Value for zerogame.MirrorOrder.
+type mirrorOrderFlag zerogame.MirrorOrder
+
+func (f *mirrorOrderFlag) String() string {
+	return zerogame.MirrorOrder(*f).String()
+}
+
+func (f *mirrorOrderFlag) Set(value string) error {
+	order, err := zerogame.ParseMirrorOrder(value)
+	if err != nil {
+		return err
+	}
+	*f = mirrorOrderFlag(order)
+	return nil
+}
+
+func (f *fetchFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.timeout, "timeout", 0, "Fails if the command takes longer than this. Running install commands are not stopped. 0 means no limit")
+	fs.DurationVar(&f.requestTimeout, "request-timeout", defaultRequestTimeout, "Fails a request that receives no data for this long")
+	fs.IntVar(&f.retries, "retries", defaultRetries, "How many times to retry a failed request")
+	fs.Var(&f.mirrorOrder, "mirror-order", "The order to try archive mirrors in: feed or latency")
+}
+
+func (f *fetchFlags) options() zerogame.FetchOptions {
+	return zerogame.FetchOptions{
+		RequestTimeout: f.requestTimeout,
+		Retries:        f.retries,
+		MirrorOrder:    zerogame.MirrorOrder(f.mirrorOrder),
+	}
+}
+
+// context returns a context that is cancelled by Ctrl-C or after -timeout.
+func (f *fetchFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if f.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
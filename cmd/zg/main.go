@@ -16,6 +16,12 @@ func main() {
 			CmdInstall(),
 			CmdUninstall(),
 			CmdRun(),
+			CmdList(),
+			CmdInfo(),
+			CmdUpdate(),
+			CmdDoctor(),
+			CmdCache(),
+			CmdBundle(),
 		},
 	}
 
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kendalharland/zerogame"
+)
+
+const progressBarWidth = 30
+
+// progressBar renders download progress as a single updating line.
+type progressBar struct {
+	w io.Writer
+}
+
+func (b *progressBar) Update(p zerogame.Progress) {
+	var line string
+	if p.BytesTotal > 0 {
+		ratio := float64(p.BytesDone) / float64(p.BytesTotal)
+		if ratio > 1 {
+			ratio = 1
+		}
+		filled := int(ratio * progressBarWidth)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+		line = fmt.Sprintf("[%s] %3.0f%% %s / %s %s/s", bar, ratio*100, formatBytes(p.BytesDone), formatBytes(p.BytesTotal), formatBytes(int64(p.Rate)))
+		if p.ETA > 0 {
+			line += " ETA " + p.ETA.Round(time.Second).String()
+		}
+	} else {
+		line = fmt.Sprintf("%s %s/s", formatBytes(p.BytesDone), formatBytes(int64(p.Rate)))
+	}
+	// Pad the line to overwrite any longer line that was rendered before it.
+	fmt.Fprintf(b.w, "\r%-80s", line)
+	if p.Done {
+		fmt.Fprintln(b.w)
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -7,12 +7,16 @@ import (
 	"io"
 	"net/url"
 	"strings"
+
+	"github.com/kendalharland/zerogame"
 )
 
 type prompt struct {
 	stdin  io.Reader
 	stdout io.Writer
 	stderr io.Writer
+
+	reader *bufio.Reader
 }
 
 func (p *prompt) ReadString(prompt string) (string, error) {
@@ -36,27 +40,59 @@ func (p *prompt) ReadOneOf(prompt string, options ...string) (string, error) {
 				return nil
 			}
 		}
-		return errors.New("please enter a valid archive type (one of: zip)")
+		return fmt.Errorf("please enter one of: %s", strings.Join(options, ", "))
 	})
 }
 
 func (p *prompt) ReadURL(prompt string) (string, error) {
+	return p.readStringUntil(prompt, validateURL)
+}
+
+// ReadOptionalURL reads a URL, or an empty string.
+func (p *prompt) ReadOptionalURL(prompt string) (string, error) {
 	return p.readStringUntil(prompt, func(value string) error {
-		u, err := url.Parse(value)
-		if err != nil {
-			return errors.New("please enter a valid URL")
+		if value == "" {
+			return nil
 		}
-		switch u.Scheme {
-		case "file", "http", "https":
+		return validateURL(value)
+	})
+}
+
+// ReadPlatform reads an optional GOOS/GOARCH platform pattern.
+func (p *prompt) ReadPlatform(prompt string) (string, error) {
+	return p.readStringUntil(prompt, func(value string) error {
+		if value == "" {
 			return nil
-		default:
-			return errors.New("only file, http, and https schemes are allowed")
 		}
+		return zerogame.ValidatePlatform(value)
+	})
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return errors.New("please enter a valid URL")
+	}
+	if _, ok := zerogame.LookupFetcher(u.Scheme); !ok {
+		return fmt.Errorf("only these schemes are allowed: %s", strings.Join(zerogame.FetcherSchemes(), ", "))
+	}
+	return nil
+}
+
+func (p *prompt) ReadVersion(prompt string) (string, error) {
+	return p.readStringUntil(prompt, func(value string) error {
+		if _, err := zerogame.ParseVersion(value); err != nil {
+			return fmt.Errorf("please enter a valid version such as 1.0.2: %v", err)
+		}
+		return nil
 	})
 }
 
 func (p *prompt) readStringUntil(prompt string, test func(string) error) (string, error) {
-	r := bufio.NewReader(p.stdin)
+	if p.reader == nil {
+		p.reader = bufio.NewReader(p.stdin)
+	}
+	r := p.reader
 	for {
 		fmt.Fprint(p.stdout, prompt)
 		value, err := r.ReadString('\n')
@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -18,30 +16,74 @@ func currentPlatform() string {
 	return runtime.GOOS
 }
 
-func getURL(u string) ([]byte, error) {
-	parsedURL, err := url.Parse(u)
-	if err != nil {
-		return nil, err
+func currentArch() string {
+	return runtime.GOARCH
+}
+
+// ValidatePlatform returns an error if platform is not a valid GOOS/GOARCH
+// pattern. See Archive.Platform for the accepted formats.
+func ValidatePlatform(platform string) error {
+	parts := strings.Split(platform, "/")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid platform %q: expected GOOS/GOARCH", platform)
 	}
-	switch parsedURL.Scheme {
-	case "file":
-		return ioutil.ReadFile(u[7:])
-	case "http", "https":
-		client := &http.Client{
-			CheckRedirect: func(r *http.Request, via []*http.Request) error {
-				r.URL.Opaque = r.URL.Path
-				return nil
-			},
-		}
-		res, err := client.Get(u)
-		if err != nil {
-			return nil, err
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid platform %q: expected GOOS/GOARCH", platform)
 		}
-		defer res.Body.Close()
-		return ioutil.ReadAll(res.Body)
+	}
+	return nil
+}
+
+// matchPlatform returns how closely pattern matches the goos/goarch platform.
+//
+// It returns -1 if the pattern does not match, and higher scores for more
+// specific matches.
+func matchPlatform(pattern, goos, goarch string) int {
+	if pattern == "" || pattern == "*" {
+		return 0
+	}
+	patternOS, patternArch := pattern, "*"
+	if i := strings.IndexByte(pattern, '/'); i >= 0 {
+		patternOS, patternArch = pattern[:i], pattern[i+1:]
+	}
+	score := 0
+	switch patternOS {
+	case goos:
+		score += 2
+	case "*":
 	default:
-		return nil, fmt.Errorf("invalid scheme: %q. must be one of: [file http https] ", u)
+		return -1
+	}
+	switch patternArch {
+	case goarch:
+		score++
+	case "*":
+	default:
+		return -1
+	}
+	return score
+}
+
+// writeFileAtomic writes data to filename without leaving a partially written
+// file behind if writing fails.
+func writeFileAtomic(filename string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
 	}
+	return os.Rename(tmp.Name(), filename)
 }
 
 func removeFileExtension(filename string) string {
@@ -52,8 +94,10 @@ func replaceFileExtension(filename, extension string) string {
 	return filename[0:len(filename)-len(filepath.Ext(filename))] + "." + extension
 }
 
-func extract(src, dst string) (files []string, err error) {
-	if filepath.Ext(src) != ".zip" {
+// extract extracts the archive at src to dst. The archive's format is
+// determined by the extension of name.
+func extract(src, name, dst string) (files []string, err error) {
+	if filepath.Ext(name) != ".zip" {
 		return nil, errors.New("only zip archives are supported")
 	}
 	return unzip(src, dst)
@@ -0,0 +1,102 @@
+package zerogame
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const configName = "config.json"
+
+// Config is the zerogame configuration file.
+//
+// It is read from config.json in the zerogame root directory, ~/.zerogame.
+type Config struct {
+	// Credentials configures how requests to private feeds are authenticated.
+	Credentials CredentialsConfig `json:"credentials"`
+
+	// Network configures the proxy and TLS settings of HTTP requests.
+	Network NetworkConfig `json:"network"`
+}
+
+// CredentialsConfig configures where credentials for private feeds come from.
+//
+// Credentials are looked up in Hosts, then in the netrc file, then by asking
+// Helper. The first source with a credential for a host wins.
+type CredentialsConfig struct {
+	// Hosts lists credentials for hosts matching a pattern.
+	Hosts []HostCredential `json:"hosts,omitempty"`
+
+	// Netrc is the path of a netrc file.
+	//
+	// Defaults to $NETRC, or ~/.netrc if NETRC is not set.
+	Netrc string `json:"netrc,omitempty"`
+
+	// Helper is an external credential helper command and its arguments.
+	//
+	// See CredentialHelper for the protocol it must implement.
+	Helper []string `json:"helper,omitempty"`
+}
+
+// HostCredential is a credential for the hosts matching a pattern.
+type HostCredential struct {
+	// Host is a host name pattern such as "builds.example.com" or
+	// "*.example.com". Patterns use path.Match syntax.
+	Host string `json:"host"`
+
+	// AllowHTTP sends the credential over plain http as well as https.
+	AllowHTTP bool `json:"allow_http,omitempty"`
+
+	Credential
+}
+
+// ConfigPath returns the path of the zerogame configuration file.
+func ConfigPath() (string, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache.dir, configName), nil
+}
+
+// LoadConfig reads the zerogame configuration file and applies the
+// overrides set in the environment. See NetworkConfig for the environment
+// variables.
+//
+// An empty Config is returned if the file does not exist.
+func LoadConfig() (*Config, error) {
+	filename, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+		}
+	}
+	config.Network.applyEnvironment()
+	return &config, nil
+}
+
+var defaultConfig struct {
+	once   sync.Once
+	config *Config
+	err    error
+}
+
+// loadDefaultConfig returns the configuration used by the default
+// credentials and HTTP client. It is read once.
+func loadDefaultConfig() (*Config, error) {
+	defaultConfig.once.Do(func() {
+		defaultConfig.config, defaultConfig.err = LoadConfig()
+	})
+	return defaultConfig.config, defaultConfig.err
+}
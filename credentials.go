@@ -0,0 +1,317 @@
+package zerogame
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Credential authenticates requests to a host.
+//
+// If Token is set it is sent as a bearer token. Otherwise Username and
+// Password are sent using basic authentication.
+type Credential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// CredentialSource chooses credentials for requests.
+type CredentialSource interface {
+	// Credential returns the credential to use for a request to u, or nil if
+	// the source has none.
+	Credential(ctx context.Context, u *url.URL) (*Credential, error)
+}
+
+// CredentialChain is a CredentialSource that returns the first credential
+// found in a list of sources.
+type CredentialChain []CredentialSource
+
+// Credential implements CredentialSource.
+func (c CredentialChain) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	for _, source := range c {
+		cred, err := source.Credential(ctx, u)
+		if err != nil || cred != nil {
+			return cred, err
+		}
+	}
+	return nil, nil
+}
+
+var defaultCredentials struct {
+	once   sync.Once
+	source CredentialSource
+	err    error
+}
+
+// DefaultCredentials returns the credential sources configured in the
+// zerogame configuration file.
+//
+// The configuration is read once, the first time DefaultCredentials is called.
+func DefaultCredentials() (CredentialSource, error) {
+	defaultCredentials.once.Do(func() {
+		config, err := loadDefaultConfig()
+		if err != nil {
+			defaultCredentials.err = err
+			return
+		}
+		defaultCredentials.source, defaultCredentials.err = NewCredentialSource(config.Credentials)
+	})
+	return defaultCredentials.source, defaultCredentials.err
+}
+
+// NewCredentialSource returns the credential sources configured by config.
+func NewCredentialSource(config CredentialsConfig) (CredentialSource, error) {
+	chain := CredentialChain{HostCredentials(config.Hosts)}
+	netrcPath := config.Netrc
+	if netrcPath == "" {
+		netrcPath = defaultNetrcPath()
+	}
+	if netrcPath != "" {
+		netrc, err := ReadNetrc(netrcPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			chain = append(chain, netrc)
+		}
+	}
+	if len(config.Helper) > 0 {
+		chain = append(chain, &CredentialHelper{Command: config.Helper})
+	}
+	return chain, nil
+}
+
+// HostCredentials is a CredentialSource that matches request hosts against
+// patterns.
+//
+// Credentials are only sent over plain http if their entry sets AllowHTTP.
+type HostCredentials []HostCredential
+
+// Credential implements CredentialSource.
+func (h HostCredentials) Credential(_ context.Context, u *url.URL) (*Credential, error) {
+	for i := range h {
+		if !isSecure(u) && !h[i].AllowHTTP {
+			continue
+		}
+		if matchHost(h[i].Host, u) {
+			return &h[i].Credential, nil
+		}
+	}
+	return nil, nil
+}
+
+func matchHost(pattern string, u *url.URL) bool {
+	pattern = strings.ToLower(pattern)
+	for _, host := range []string{strings.ToLower(u.Host), strings.ToLower(u.Hostname())} {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecure reports whether credentials can be sent in requests for u without
+// being readable on the network.
+func isSecure(u *url.URL) bool {
+	return !strings.EqualFold(u.Scheme, "http")
+}
+
+// Netrc is a CredentialSource backed by a netrc file.
+//
+// Like the go command, Netrc ignores the default entry, which would send the
+// same credential to every host. Credentials are never sent over plain http.
+type Netrc struct {
+	machines map[string]Credential
+}
+
+func defaultNetrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// ReadNetrc parses the netrc file at filename.
+func ReadNetrc(filename string) (*Netrc, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(data), nil
+}
+
+func parseNetrc(data []byte) *Netrc {
+	n := &Netrc{machines: make(map[string]Credential)}
+	var machine string
+	var current *Credential
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if _, ok := n.machines[machine]; !ok {
+			n.machines[machine] = *current
+		}
+		current = nil
+	}
+
+	var inMacro bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// Macro definitions end at the first empty line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			next := func() string {
+				if i+1 < len(fields) {
+					i++
+					return fields[i]
+				}
+				return ""
+			}
+			switch fields[i] {
+			case "machine":
+				flush()
+				machine = strings.ToLower(next())
+				current = &Credential{}
+			case "default":
+				// The default entry's login and password are ignored.
+				flush()
+			case "login":
+				if v := next(); current != nil {
+					current.Username = v
+				}
+			case "password":
+				if v := next(); current != nil {
+					current.Password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				next()
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	flush()
+	return n
+}
+
+// Credential implements CredentialSource.
+func (n *Netrc) Credential(_ context.Context, u *url.URL) (*Credential, error) {
+	if !isSecure(u) {
+		return nil, nil
+	}
+	if cred, ok := n.machines[strings.ToLower(u.Hostname())]; ok {
+		return &cred, nil
+	}
+	return nil, nil
+}
+
+// CredentialHelper is a CredentialSource that asks an external program for
+// credentials, like git's credential helpers.
+//
+// The helper is run with a "get" argument. The request is written to its
+// standard input as key=value lines followed by an empty line:
+//
+//	protocol=https
+//	host=builds.example.com
+//	path=games/feed.json
+//
+// The helper writes any of the username, password and token keys to its
+// standard output in the same format, or nothing if it has no credential.
+type CredentialHelper struct {
+	// Command is the helper's command and arguments.
+	Command []string
+
+	mu    sync.Mutex
+	cache map[string]*Credential
+}
+
+// Credential implements CredentialSource.
+//
+// The helper is run at most once per protocol and host. It is not run for
+// plain http requests.
+func (h *CredentialHelper) Credential(ctx context.Context, u *url.URL) (*Credential, error) {
+	if !isSecure(u) {
+		return nil, nil
+	}
+	key := u.Scheme + "://" + u.Host
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cred, ok := h.cache[key]; ok {
+		return cred, nil
+	}
+	cred, err := h.run(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if h.cache == nil {
+		h.cache = make(map[string]*Credential)
+	}
+	h.cache[key] = cred
+	return cred, nil
+}
+
+func (h *CredentialHelper) run(ctx context.Context, u *url.URL) (*Credential, error) {
+	if len(h.Command) == 0 {
+		return nil, nil
+	}
+	args := append(append([]string{}, h.Command[1:]...), "get")
+	cmd := exec.CommandContext(ctx, h.Command[0], args...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/")))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %v failed: %w", h.Command, err)
+	}
+	return parseHelperOutput(out), nil
+}
+
+// parseHelperOutput parses the key=value lines written by a credential
+// helper. It returns nil if the output has no credential.
+func parseHelperOutput(out []byte) *Credential {
+	var cred Credential
+	var found bool
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "username":
+			cred.Username, found = parts[1], true
+		case "password":
+			cred.Password, found = parts[1], true
+		case "token":
+			cred.Token, found = parts[1], true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &cred
+}
@@ -0,0 +1,144 @@
+package zerogame
+
+import (
+	"context"
+	"net/url"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestNetrcCredential(t *testing.T) {
+	netrc := parseNetrc([]byte(`
+machine builds.example.com login alice password secret
+machine Mirror.Example.com
+	login bob
+	account ignored
+	password hunter2
+
+macdef init
+machine macro.example.com login mallory password evil
+
+machine builds.example.com login duplicate password ignored
+default login anonymous password guest
+`))
+	tests := []struct {
+		url  string
+		want *Credential
+	}{
+		{"https://builds.example.com/feed.json", &Credential{Username: "alice", Password: "secret"}},
+		{"https://builds.example.com:8443/feed.json", &Credential{Username: "alice", Password: "secret"}},
+		{"https://mirror.example.com/game.zip", &Credential{Username: "bob", Password: "hunter2"}},
+		{"https://macro.example.com/game.zip", nil},
+		{"https://other.example.com/game.zip", nil},
+		{"http://builds.example.com/feed.json", nil},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := netrc.Credential(context.Background(), u)
+		if err != nil {
+			t.Fatalf("Credential(%s) = %v", tt.url, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Credential(%s) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNetrcWithoutDefault(t *testing.T) {
+	netrc := parseNetrc([]byte("machine builds.example.com login alice password secret\n"))
+	u, _ := url.Parse("https://other.example.com/feed.json")
+	got, err := netrc.Credential(context.Background(), u)
+	if err != nil || got != nil {
+		t.Errorf("Credential() = %+v, %v, want no credential", got, err)
+	}
+}
+
+func TestHostCredentialsOverHTTP(t *testing.T) {
+	hosts := HostCredentials{
+		{Host: "builds.example.com", Credential: Credential{Token: "secret"}},
+		{Host: "local.example.com", AllowHTTP: true, Credential: Credential{Token: "local"}},
+	}
+	tests := []struct {
+		url  string
+		want *Credential
+	}{
+		{"https://builds.example.com/feed.json", &Credential{Token: "secret"}},
+		{"http://builds.example.com/feed.json", nil},
+		{"https://local.example.com/feed.json", &Credential{Token: "local"}},
+		{"http://local.example.com/feed.json", &Credential{Token: "local"}},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := hosts.Credential(context.Background(), u)
+		if err != nil {
+			t.Fatalf("Credential(%s) = %v", tt.url, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Credential(%s) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestParseHelperOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want *Credential
+	}{
+		{
+			name: "username and password",
+			out:  "username=alice\npassword=a=b=c\n",
+			want: &Credential{Username: "alice", Password: "a=b=c"},
+		},
+		{
+			name: "token",
+			out:  "token=abc123\nquit=1\n",
+			want: &Credential{Token: "abc123"},
+		},
+		{
+			name: "no credential",
+			out:  "protocol=https\nhost=builds.example.com\n\n",
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseHelperOutput([]byte(tt.out)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHelperOutput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	// The helper echoes the requested host back as the username, so the test
+	// also checks what it was sent.
+	helper := &CredentialHelper{Command: []string{"sh", "-c", `
+[ "$1" = get ] || exit 1
+while read line && [ -n "$line" ]; do
+	case "$line" in host=*) echo "username=${line#host=}" ;; esac
+done
+echo password=secret
+`, "helper"}}
+	u, _ := url.Parse("https://builds.example.com/games/feed.json")
+	got, err := helper.Credential(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Credential() = %v", err)
+	}
+	want := &Credential{Username: "builds.example.com", Password: "secret"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Credential() = %+v, want %+v", got, want)
+	}
+}
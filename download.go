@@ -0,0 +1,335 @@
+package zerogame
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// interruptedError is returned when a download fails part way through because
+// the archive could not be read from the server.
+//
+// The partially downloaded file is kept so that the download can be resumed.
+type interruptedError struct {
+	url string
+	err error
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("download of %s was interrupted: %v. run the command again to resume it", e.url, e.err)
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+// writeError is returned when the downloaded contents could not be written,
+// such as when signature verification stopped reading the archive.
+//
+// Downloads that fail with a writeError are not resumed, since running the
+// command again would fail the same way.
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// archiveWriter wraps the errors of w in writeError.
+type archiveWriter struct {
+	w io.Writer
+}
+
+func (w archiveWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		err = &writeError{err: err}
+	}
+	return n, err
+}
+
+// errCannotResume is returned when a download cannot continue from where it
+// stopped.
+var errCannotResume = errors.New("cannot resume the download")
+
+// partialFile is a partially downloaded archive.
+//
+// The URL and validators of the download are stored next to the file so that
+// a later download can check whether the partial contents are still valid.
+type partialFile struct {
+	*os.File
+}
+
+// partialMeta describes the download a partialFile came from.
+type partialMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func partialMetaPath(filename string) string {
+	return filename + ".json"
+}
+
+// validator returns the value to send as an If-Range header, or the empty
+// string if the download cannot be safely resumed.
+func (m partialMeta) validator() string {
+	// If-Range only accepts strong ETags.
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// matches reports whether res is the same version of the contents m was
+// saved for.
+func (m partialMeta) matches(res *FetchResponse) bool {
+	if m.ETag != "" && res.ETag != "" {
+		return m.ETag == res.ETag
+	}
+	return m.LastModified != "" && m.LastModified == res.LastModified
+}
+
+func (f *partialFile) readMeta() partialMeta {
+	var m partialMeta
+	data, err := ioutil.ReadFile(partialMetaPath(f.Name()))
+	if err == nil {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+func (f *partialFile) writeMeta(m partialMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(partialMetaPath(f.Name()), data, 0644)
+}
+
+// reset discards the partial contents.
+func (f *partialFile) reset() error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// remove deletes the partial file and its metadata.
+func (f *partialFile) remove() {
+	os.Remove(f.Name())
+	os.Remove(partialMetaPath(f.Name()))
+}
+
+// resumeDownload opens u to continue the download in f.
+//
+// The partial contents of f are kept only if the server still has the same
+// version of the contents and supports range requests. Otherwise f is reset
+// and the download starts over.
+func (f *partialFile) resumeDownload(ctx context.Context, d *downloader, u string) (*FetchResponse, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size()
+	meta := f.readMeta()
+	if meta.URL != u || meta.validator() == "" {
+		offset = 0
+	}
+
+	res, err := d.openURL(ctx, u, offset, meta.validator())
+	var httpErr *HTTPError
+	if offset > 0 && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		res, err = d.openURL(ctx, u, 0, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 && (res.Offset != offset || !meta.matches(res)) {
+		if res.Offset != 0 {
+			res.Body.Close()
+			if res, err = d.openURL(ctx, u, 0, ""); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Fprintln(os.Stderr, "Cannot resume the previous download. Starting over")
+	}
+	if res.Offset == 0 {
+		if err := f.reset(); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Resuming download at byte %d\n", res.Offset)
+	}
+	if err := f.writeMeta(partialMeta{URL: u, ETag: res.ETag, LastModified: res.LastModified}); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// streamArchive downloads archive to dst and w, and returns its size and
+// SHA-256 hash.
+//
+// The archive's mirrors are tried in the order chosen by d.opts.MirrorOrder.
+// When a mirror fails part way through, the download continues from the next
+// mirror at the same offset, since every mirror serves the same file.
+func (d *downloader) streamArchive(ctx context.Context, archive *Archive, dst *partialFile, w io.Writer) (int64, []byte, error) {
+	urls := d.orderMirrors(ctx, archive.urls())
+	hash := sha256.New()
+	writers := []io.Writer{hash, w}
+	if dst != nil {
+		writers = append(writers, dst)
+	}
+
+	var n int64
+	var meta partialMeta
+	var pw *progressWriter
+	var err error
+	var u string
+	started := false
+	for i := range urls {
+		u = urls[i]
+		if len(urls) > 1 {
+			fmt.Fprintf(os.Stderr, "Downloading from mirror %s\n", u)
+		}
+		err = d.retry(ctx, u, func() error {
+			var res *FetchResponse
+			var err error
+			var body io.Reader
+			if !started {
+				if dst != nil {
+					res, err = dst.resumeDownload(ctx, d, u)
+				} else {
+					res, err = d.openURL(ctx, u, 0, "")
+				}
+				if err != nil {
+					return err
+				}
+				defer res.Body.Close()
+				started = true
+				meta = partialMeta{URL: u, ETag: res.ETag, LastModified: res.LastModified}
+
+				if res.Offset > 0 {
+					// Replay the partial contents so the hash and signature cover
+					// the entire archive.
+					if _, err := dst.Seek(0, io.SeekStart); err != nil {
+						return err
+					}
+					if _, err := io.CopyN(archiveWriter{io.MultiWriter(hash, w)}, dst, res.Offset); err != nil {
+						return err
+					}
+				}
+				br := bufio.NewReader(res.Body)
+				if head, _ := br.Peek(sniffLen); res.Offset == 0 && isHTML(head) {
+					return &HTMLResponseError{URL: u}
+				}
+				body = br
+				n = res.Offset
+
+				size := res.Size
+				if size < 0 && archive.ArchiveSize > 0 {
+					size = archive.ArchiveSize
+				}
+				pw = newProgressWriter(u, n, size, d.progress)
+			} else {
+				if body, err = d.continueDownload(ctx, u, n, meta); err != nil {
+					return err
+				}
+				defer body.(io.Closer).Close()
+			}
+			copied, err := io.Copy(archiveWriter{io.MultiWriter(append(writers, pw)...)}, body)
+			n += copied
+			return err
+		})
+		var writeErr *writeError
+		if err == nil || ctx.Err() != nil || errors.As(err, &writeErr) {
+			break
+		}
+		if i+1 < len(urls) {
+			fmt.Fprintf(os.Stderr, "Mirror %s failed: %v\n", u, err)
+		}
+	}
+	if pw != nil {
+		pw.finish()
+	}
+	if err != nil {
+		var htmlErr *HTMLResponseError
+		var writeErr *writeError
+		switch {
+		case !started:
+			return 0, nil, fmt.Errorf("feed archive URL is invalid: %w", err)
+		case errors.As(err, &htmlErr):
+			return 0, nil, err
+		case errors.As(err, &writeErr), errors.Is(err, errCannotResume):
+			return n, nil, fmt.Errorf("failed to download %s: %w", u, err)
+		case dst != nil:
+			return n, nil, &interruptedError{url: u, err: err}
+		default:
+			return n, nil, fmt.Errorf("failed to download %s: %w", u, err)
+		}
+	}
+	if len(urls) > 1 {
+		fmt.Fprintf(os.Stderr, "Downloaded the archive from mirror %s\n", u)
+	}
+	return n, hash.Sum(nil), nil
+}
+
+// continueDownload opens u to continue a download that stopped at offset n.
+//
+// If u is the URL the download started from, its contents must not have
+// changed since. Otherwise u is a mirror of the same file, and the bytes
+// before n are skipped if the mirror does not support range requests.
+//
+// If n is zero, the response is checked for an HTML page like the first
+// response of a download.
+func (d *downloader) continueDownload(ctx context.Context, u string, n int64, meta partialMeta) (io.ReadCloser, error) {
+	var ifRange string
+	if u == meta.URL && n > 0 {
+		if ifRange = meta.validator(); ifRange == "" {
+			return nil, fmt.Errorf("%w of %s: the server did not send an ETag or Last-Modified header", errCannotResume, u)
+		}
+	}
+	res, err := d.openURL(ctx, u, n, ifRange)
+	if err != nil {
+		return nil, err
+	}
+	if res.Offset > n || (u == meta.URL && n > 0 && !meta.matches(res)) {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w of %s: the archive changed or the server does not support range requests", errCannotResume, u)
+	}
+	if n == 0 {
+		br := bufio.NewReader(res.Body)
+		if head, _ := br.Peek(sniffLen); isHTML(head) {
+			res.Body.Close()
+			return nil, &HTMLResponseError{URL: u}
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, res.Body}, nil
+	}
+	if res.Offset < n {
+		if _, err := io.CopyN(ioutil.Discard, res.Body, n-res.Offset); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Resuming download at byte %d\n", n)
+	return res.Body, nil
+}
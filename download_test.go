@@ -0,0 +1,217 @@
+package zerogame
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testArchive = []byte(strings.Repeat("0123456789abcdef", 1024))
+
+// archiveServer serves testArchive with an ETag and records the Range
+// headers it receives.
+type archiveServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	etag   string
+	ranges []string
+}
+
+func newArchiveServer(t *testing.T, etag string) *archiveServer {
+	t.Helper()
+	s := &archiveServer{etag: etag}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+		w.Header().Set("ETag", s.etag)
+		http.ServeContent(w, r, "game.zip", time.Time{}, bytes.NewReader(testArchive))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *archiveServer) requestedRanges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.ranges...)
+}
+
+// newTestPartialDownload returns a partial file holding contents, downloaded
+// from a server described by meta.
+func newTestPartialDownload(t *testing.T, contents []byte, meta partialMeta) *partialFile {
+	t.Helper()
+	dst := newTestPartialFile(t)
+	if _, err := dst.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.writeMeta(meta); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// checkDownloadedArchive checks that dst holds testArchive and that size and
+// sum describe it.
+func checkDownloadedArchive(t *testing.T, dst *partialFile, size int64, sum []byte) {
+	t.Helper()
+	want := sha256.Sum256(testArchive)
+	if size != int64(len(testArchive)) || !bytes.Equal(sum, want[:]) {
+		t.Errorf("streamArchive() = %d bytes with hash %x, want %d bytes with hash %x", size, sum, len(testArchive), want)
+	}
+	got, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, testArchive) {
+		t.Errorf("partial file holds %d bytes that differ from the archive", len(got))
+	}
+}
+
+func TestStreamArchiveResumesWithMatchingValidator(t *testing.T) {
+	server := newArchiveServer(t, `"v1"`)
+	u := server.URL + "/game.zip"
+	dst := newTestPartialDownload(t, testArchive[:1000], partialMeta{URL: u, ETag: `"v1"`})
+
+	d := newDownloader(FetchOptions{}, nil)
+	size, sum, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: u}, dst, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("streamArchive() = %v", err)
+	}
+	checkDownloadedArchive(t, dst, size, sum)
+	if got := server.requestedRanges(); len(got) != 1 || got[0] != "bytes=1000-" {
+		t.Errorf("server received ranges %q, want one request for bytes=1000-", got)
+	}
+}
+
+func TestStreamArchiveStartsOverWhenArchiveChanged(t *testing.T) {
+	server := newArchiveServer(t, `"v2"`)
+	u := server.URL + "/game.zip"
+	// The partial contents belong to an older version of the archive.
+	dst := newTestPartialDownload(t, bytes.Repeat([]byte("x"), 1000), partialMeta{URL: u, ETag: `"v1"`})
+
+	d := newDownloader(FetchOptions{}, nil)
+	size, sum, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: u}, dst, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("streamArchive() = %v", err)
+	}
+	checkDownloadedArchive(t, dst, size, sum)
+	if meta := dst.readMeta(); meta.ETag != `"v2"` {
+		t.Errorf("partial metadata has ETag %s, want %s", meta.ETag, `"v2"`)
+	}
+}
+
+func TestStreamArchiveStartsOverWhenPartialMetaDoesNotMatch(t *testing.T) {
+	server := newArchiveServer(t, `"v1"`)
+	u := server.URL + "/game.zip"
+	// The partial contents were downloaded from a different URL.
+	dst := newTestPartialDownload(t, bytes.Repeat([]byte("x"), 1000), partialMeta{URL: server.URL + "/other.zip", ETag: `"v1"`})
+
+	d := newDownloader(FetchOptions{}, nil)
+	size, sum, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: u}, dst, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("streamArchive() = %v", err)
+	}
+	checkDownloadedArchive(t, dst, size, sum)
+	if got := server.requestedRanges(); len(got) != 1 || got[0] != "" {
+		t.Errorf("server received ranges %q, want one request for the whole archive", got)
+	}
+}
+
+func TestStreamArchiveKeepsPartialFileWhenInterrupted(t *testing.T) {
+	var mu sync.Mutex
+	interrupt := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if interrupt && r.Header.Get("Range") == "" {
+			// Send half of the archive and drop the connection.
+			w.Header().Set("Content-Length", "16384")
+			w.Write(testArchive[:8192])
+			return
+		}
+		http.ServeContent(w, r, "game.zip", time.Time{}, bytes.NewReader(testArchive))
+	}))
+	defer server.Close()
+	u := server.URL + "/game.zip"
+	dst := newTestPartialFile(t)
+
+	d := newDownloader(FetchOptions{}, nil)
+	_, _, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: u}, dst, ioutil.Discard)
+	var interrupted *interruptedError
+	if !errors.As(err, &interrupted) {
+		t.Fatalf("streamArchive() = %v, want an interruptedError", err)
+	}
+
+	mu.Lock()
+	interrupt = false
+	mu.Unlock()
+	size, sum, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: u}, dst, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("streamArchive() after interruption = %v", err)
+	}
+	checkDownloadedArchive(t, dst, size, sum)
+}
+
+func TestStreamArchiveDoesNotResumeWriteErrors(t *testing.T) {
+	server := newArchiveServer(t, `"v1"`)
+	dst := newTestPartialFile(t)
+
+	d := newDownloader(FetchOptions{}, nil)
+	writeErr := errors.New("rejected")
+	_, _, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: server.URL + "/game.zip"}, dst, failingWriter{writeErr})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("streamArchive() = %v, want %v", err, writeErr)
+	}
+	var interrupted *interruptedError
+	if errors.As(err, &interrupted) {
+		t.Fatalf("streamArchive() = %v, want an error that is not resumable", err)
+	}
+}
+
+func TestStreamArchiveRejectsHTMLWhenRetryingFromStart(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		if first {
+			// Send the headers and drop the connection before the body.
+			w.Header().Set("Content-Length", "16384")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<!DOCTYPE html><html><body>Sign in</body></html>"))
+	}))
+	defer server.Close()
+	dst := newTestPartialFile(t)
+
+	d := newDownloader(FetchOptions{Retries: 1, RetryBackoff: time.Millisecond}, nil)
+	_, _, err := d.streamArchive(context.Background(), &Archive{ArchiveURL: server.URL + "/game.zip"}, dst, ioutil.Discard)
+	var htmlErr *HTMLResponseError
+	if !errors.As(err, &htmlErr) {
+		t.Fatalf("streamArchive() = %v, want an HTMLResponseError", err)
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
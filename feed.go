@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 )
@@ -21,13 +24,19 @@ const (
 	// AutoSelectMethod automatically determines which verification method to use.
 	AutoSelectMethod VerificationMethod = "DefaultMethod"
 
-	// DoNotVerifyMethod disables feed archive verification.
+	// DoNotVerifyMethod disables feed archive signature verification.
+	//
+	// The archive's size and SHA-256 hash are still checked if the feed has
+	// them, so truncated downloads and error pages are never installed.
 	DoNotVerifyMethod VerificationMethod = "NoVerification"
 
 	// GPGDetachedSignatureMethod verifies archives signed with detached GPG signatures.
 	//
 	// The signer's public key must exist in the key ring.
 	GPGDetachedSignatureMethod VerificationMethod = "DetachedSignatureMethod"
+
+	// ChecksumMethod verifies archives using the SHA-256 hash in their feed.
+	ChecksumMethod VerificationMethod = "ChecksumMethod"
 )
 
 // Feed describes an archive to install.
@@ -37,27 +46,188 @@ type Feed struct {
 	// Required.
 	Name string `json:"name"`
 
-	// Version is this feed's version string.
+	// ID identifies this Feed independently of the URL it is published at,
+	// such as "com.example.my_game".
+	//
+	// Feeds with the same ID are the same game, so a game can be moved to a
+	// new URL without being installed twice. If SigningKey is set, the ID
+	// only matches feeds signed by the same key. Feeds at other URLs only
+	// replace an installed game with the same ID if the ID has a signing key.
+	ID string `json:"id,omitempty"`
+
+	// SigningKey is the fingerprint of the GPG key that signs this Feed's
+	// archives.
+	//
+	// If set, archives must be signed by this key rather than by any key in
+	// the user's keyring.
+	SigningKey string `json:"signing_key,omitempty"`
+
+	// MovedTo is the URL this Feed is now published at, which may be relative
+	// to the Feed's URL.
 	//
-	// This is used to distinguish between feeds with the same name.
+	// Installed feeds are updated from the new URL from then on. A Feed with
+	// an ID may only move to a Feed with the same ID.
+	MovedTo string `json:"moved_to,omitempty"`
+
+	// Release is this feed's only release.
+	//
+	// Feeds with a single release may describe it using these top-level fields
+	// instead of Releases. It is ignored if Releases is not empty.
+	Release
+
+	// Releases lists every release of this feed.
+	Releases []Release `json:"releases,omitempty"`
+}
+
+// Release is a single version of a Feed's archive.
+type Release struct {
+	// Version is this release's version string.
+	//
+	// This is used to distinguish between releases of the same feed.
 	//
 	// Required.
-	Version string `json:"version"`
+	Version string `json:"version,omitempty"`
+
+	// Archive is this release's only archive.
+	//
+	// Releases with a single archive for every platform may describe it using
+	// these fields instead of Archives. It is used as a fallback if none of
+	// Archives matches the current platform.
+	Archive
+
+	// Archives lists this release's platform-specific archives.
+	Archives []Archive `json:"archives,omitempty"`
+
+	// Channel is the release channel this release was published to.
+	//
+	// Defaults to StableChannel.
+	Channel Channel `json:"channel,omitempty"`
+}
+
+// Archive is a downloadable archive of a Release.
+type Archive struct {
+	// Platform is the GOOS/GOARCH pair this archive can be installed on.
+	//
+	// Either part may be a "*" wildcard, and a missing GOARCH matches every
+	// architecture. For example: "linux/amd64", "linux/*", "windows".
+	// Empty matches every platform.
+	Platform string `json:"platform,omitempty"`
 
-	// ArchiveuRL is used to GET this feed's archive.
+	// ArchiveuRL is used to GET this archive.
 	//
 	// Required.
-	ArchiveURL string `json:"archive_url"`
+	ArchiveURL string `json:"archive_url,omitempty"`
+
+	// Mirrors are other URLs that serve the same archive.
+	//
+	// They are tried when ArchiveURL fails, and every download is verified the
+	// same way whichever URL it came from.
+	Mirrors []string `json:"mirrors,omitempty"`
 
 	// ArcchiveType is the archive file's extension.
 	//
 	// This is always zip and exists to extend support to future archive types.
 	//
 	// Required.
-	ArchiveType string `json:"archive_type"`
+	ArchiveType string `json:"archive_type,omitempty"`
+
+	// GPGSignatureURL is used to GET this archive's GPG signature.
+	GPGSignatureURL string `json:"gpg_signature_url,omitempty"`
+
+	// GPGSignatureMirrors are other URLs that serve the same GPG signature.
+	GPGSignatureMirrors []string `json:"gpg_signature_mirrors,omitempty"`
 
-	// GPGSignatureURL is used to GET this feed's archive's GPG signature.
-	GPGSignatureURL string `json:"gpg_signature_url"`
+	// ArchiveSHA256 is the hex-encoded SHA-256 hash of this archive.
+	//
+	// If set, every download of the archive is checked against it.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+
+	// ArchiveSize is the size of this archive in bytes.
+	//
+	// If set, every download of the archive is checked against it.
+	ArchiveSize int64 `json:"archive_size,omitempty"`
+}
+
+// SelectArchive returns the archive of this release that best matches the
+// goos/goarch platform.
+//
+// An exact match is preferred over a wildcard match.
+func (r *Release) SelectArchive(goos, goarch string) (*Archive, error) {
+	candidates := r.Archives
+	if r.ArchiveURL != "" {
+		candidates = append(append([]Archive{}, r.Archives...), r.Archive)
+	}
+	var best *Archive
+	bestScore := -1
+	for i := range candidates {
+		if score := matchPlatform(candidates[i].Platform, goos, goarch); score > bestScore {
+			best, bestScore = &candidates[i], score
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("release %s has no archive for %s/%s", r.Version, goos, goarch)
+	}
+	return best, nil
+}
+
+// AllReleases returns every release of this feed.
+func (f *Feed) AllReleases() []Release {
+	if len(f.Releases) > 0 {
+		return f.Releases
+	}
+	return []Release{f.Release}
+}
+
+// SelectRelease returns the release of this feed with the given version.
+//
+// If version is empty, the newest release available in channel is returned.
+func (f *Feed) SelectRelease(version string, channel Channel) (*Release, error) {
+	releases := f.AllReleases()
+	if version != "" {
+		for i := range releases {
+			if sameVersion(releases[i].Version, version) {
+				return &releases[i], nil
+			}
+		}
+		return nil, fmt.Errorf("feed %q has no release with version %q", f.Name, version)
+	}
+
+	var newest *Release
+	for i := range releases {
+		if !channel.includes(releases[i].Channel) {
+			continue
+		}
+		if newest == nil || !isDowngrade(newest.Version, releases[i].Version) {
+			newest = &releases[i]
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("feed %q has no releases in the %s channel", f.Name, channel)
+	}
+	return newest, nil
+}
+
+// selectRelease returns a single-release copy of feed containing the release
+// selected by version and channel, and only the archive for this platform.
+func selectRelease(feed *Feed, version string, channel Channel) (*Feed, error) {
+	release, err := feed.SelectRelease(version, channel)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := release.SelectArchive(currentPlatform(), currentArch())
+	if err != nil {
+		return nil, err
+	}
+	return &Feed{
+		Name:       feed.Name,
+		ID:         feed.ID,
+		SigningKey: feed.SigningKey,
+		Release: Release{
+			Version: release.Version,
+			Archive: *archive,
+			Channel: release.Channel,
+		},
+	}, nil
 }
 
 // InstallFile describes how to install an archive on several platforms.
@@ -67,6 +237,9 @@ type InstallFile struct {
 
 // Platform is a platform-specific installation configuration.
 type Platform struct {
+	// Name is the GOOS or GOOS/GOARCH pair this configuration applies to.
+	//
+	// See Archive.Platform for the accepted formats.
 	Name string `json:"name"`
 
 	// Installs the archive.
@@ -83,6 +256,11 @@ type Platform struct {
 	//
 	// Required.
 	RunCommand []string `json:"run"`
+
+	// Prepares the installed archive to be replaced by a newer version.
+	//
+	// If empty, UninstallCommand is used instead.
+	UpgradeCommand []string `json:"upgrade,omitempty"`
 }
 
 // InstallFeedOptions configures a call to InstallFeed.
@@ -92,150 +270,679 @@ type InstallFeedOptions struct {
 
 	// VerificationMethod controls how an archive is verified.
 	VerificationMethod VerificationMethod
+
+	// AllowDowngrade controls whether an installed feed may be replaced by an
+	// older version.
+	AllowDowngrade bool
+
+	// Version selects the release to install.
+	//
+	// If set, the installed feed is pinned to this version and is skipped by
+	// UpdateFeeds. UseCache is ignored if Version or Channel is set.
+	Version string
+
+	// Channel selects the channel to install the newest release from.
+	//
+	// Defaults to StableChannel.
+	Channel Channel
+
+	// Progress is called periodically while the archive is downloaded.
+	Progress ProgressFunc
+
+	// FetchOptions configures how the feed and its archive are fetched.
+	FetchOptions FetchOptions
+
+	// Offline controls whether the feed and its archive are only loaded from
+	// the cache, without using the network.
+	//
+	// The cached archive is verified again against the cached feed. If the
+	// feed, archive or signature is not cached, InstallFeed fails with an
+	// error wrapping ErrNotCached.
+	Offline bool
 }
 
 // InstallFeed downloads feedURL and installs the corresponding archive on this machine.
-func InstallFeed(_ context.Context, feedURL string, opts InstallFeedOptions) error {
-	if strings.HasPrefix(feedURL, "file://") {
-		feedURL = "file://" + filepath.Clean(feedURL[7:])
-	}
+func InstallFeed(ctx context.Context, feedURL string, opts InstallFeedOptions) error {
+	feedURL = normalizeFeedURL(feedURL)
 
 	cache, err := newDefaultCache()
 	if err != nil {
 		return err
 	}
 
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return err
+	}
+
+	d := newDownloader(opts.FetchOptions, opts.Progress)
+	useCache := opts.UseCache && opts.Version == "" && opts.Channel == ""
 	var feed *Feed
-	if !opts.UseCache || !cache.FeedArchiveExists(feedURL) {
+	if opts.Offline {
+		fmt.Fprintf(os.Stderr, "Loading feed %s from cache\n", feedURL)
+		feed, err = cache.loadOfflineFeed(feedURL, opts)
+		if err != nil {
+			return err
+		}
+		if err := cache.checkDowngrade(reg, feedURL, feed, opts.AllowDowngrade); err != nil {
+			return err
+		}
+	} else if !useCache || !cache.FeedArchiveExists(feedURL) {
 		fmt.Fprintf(os.Stderr, "Downloading feed: %s\n", feedURL)
-		feed, err = fetchFeed(feedURL)
+		feed, feedURL, err = cache.fetchCanonicalFeed(ctx, d, feedURL)
 		if err != nil {
 			return err
 		}
-		archive, err := fetchFeedArchive(feed, opts.VerificationMethod)
+		feed, err = selectRelease(feed, opts.Version, opts.Channel)
 		if err != nil {
-			return fmt.Errorf("failed to verify feed: %w. aborting", err)
+			return err
 		}
-
-		if err := cache.WriteFeedArchive(feedURL, feed, archive, 0755); err != nil {
-			return fmt.Errorf("failed to cache feed archive: %w. aborting", err)
+		if err := cache.checkDowngrade(reg, feedURL, feed, opts.AllowDowngrade); err != nil {
+			return err
+		}
+		if cache.cachedArchiveMatches(feedURL, feed) {
+			fmt.Fprintf(os.Stderr, "Archive %s is already cached\n", feedArchiveName(feed))
+		} else if err := cache.downloadFeedArchive(ctx, d, feedURL, feed, opts.VerificationMethod); err != nil {
+			return err
 		}
 	} else {
 		fmt.Fprintf(os.Stderr, "Loading feed %s from cache\n", feedURL)
 	}
 
-	archivePath, _ := cache.GetFeedArchive(feedURL)
-	if err := installArchive(archivePath); err != nil {
-		return fmt.Errorf("installation failed: %w", err)
+	if err := cache.installFeed(ctx, reg, feedURL, feed, opts.Channel, opts.Version != ""); err != nil {
+		return err
 	}
 	fmt.Fprintln(os.Stderr, "Installation complete!")
 	return nil
 }
 
-func installArchive(archivePath string) error {
-	dir := removeFileExtension(archivePath)
-	files, err := extract(archivePath, dir)
+// checkDowngrade returns ErrDowngrade if installing feed would replace an
+// installed version of feedURL, or of the feed with the same signed ID, with
+// an older version.
+func (c cache) checkDowngrade(reg *registry, feedURL string, feed *Feed, allowDowngrade bool) error {
+	installed, err := reg.findFeed(feedURL, c.signedFeedID(feed.ID))
+	if err != nil || !isDowngrade(installed.Version, feed.Version) {
+		return nil
+	}
+	if allowDowngrade {
+		fmt.Fprintf(os.Stderr, "Downgrading %s from %s to %s\n", feed.Name, installed.Version, feed.Version)
+		return nil
+	}
+	return fmt.Errorf("%w %s from %s to %s", ErrDowngrade, feed.Name, installed.Version, feed.Version)
+}
+
+// downloadFeedArchive fetches and verifies feed's archive and writes it to the cache.
+//
+// The archive is streamed to a partial file which is only moved into place
+// once it has been verified. If the download is interrupted, the partial file
+// is kept and the next download resumes from where it stopped.
+func (c cache) downloadFeedArchive(ctx context.Context, d *downloader, feedURL string, feed *Feed, method VerificationMethod) error {
+	if dl := c.reuseBlob(ctx, d, feed, method); dl != nil {
+		fmt.Fprintf(os.Stderr, "Archive %s is already stored. Not downloading it again\n", feedArchiveName(feed))
+		if err := c.writeFeedEntry(feedURL, feed, dl); err != nil {
+			return fmt.Errorf("failed to cache feed archive: %w. aborting", err)
+		}
+		return nil
+	}
+	dst, err := c.OpenPartialFeedArchive(feedURL, feed)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to cache feed archive: %w. aborting", err)
 	}
-	for _, file := range files {
-		if filepath.Base(file) != "install.json" {
-			continue
+	dl, err := d.fetchFeedArchive(ctx, feed, method, dst)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var interrupted *interruptedError
+		if !errors.As(err, &interrupted) {
+			dst.remove()
 		}
-		data, err := ioutil.ReadFile(file)
-		if err != nil {
+		return fmt.Errorf("failed to verify feed: %w. aborting", err)
+	}
+	if err := c.WriteFeedArchive(feedURL, feed, dst.Name(), 0755, dl); err != nil {
+		return fmt.Errorf("failed to cache feed archive: %w. aborting", err)
+	}
+	return nil
+}
+
+// installFeed installs the cached archive of feedURL and records it in reg.
+//
+// feed is nil if the archive was loaded from the cache without fetching the
+// feed. Otherwise it is the single-release feed that was downloaded. channel
+// and pinned are recorded for UpdateFeeds.
+//
+// If a different version of the feed is installed, it is replaced. Feeds with
+// an ID bound to a signing key replace the installed feed with the same ID,
+// even if it was installed from a different URL, once their archive was
+// verified with that key.
+//
+// The feed's ID is only bound to feedURL, and to its signing key, once the
+// feed is installed.
+func (c cache) installFeed(ctx context.Context, reg *registry, feedURL string, feed *Feed, channel Channel, pinned bool) error {
+	cached, err := c.GetFeedArchive(feedURL)
+	if err != nil {
+		return fmt.Errorf("installation failed: %w", err)
+	}
+	archivePath := cached.Path
+	if err := cached.touch(); err != nil {
+		return fmt.Errorf("failed to update %s: %w", archivePath, err)
+	}
+	sum, err := cached.sha256()
+	if err != nil {
+		return fmt.Errorf("installation failed: %w", err)
+	}
+	var feedID string
+	if feed != nil {
+		feedID = feed.ID
+	} else if ident := c.identityOf(feedURL); ident != nil {
+		feedID = ident.ID
+	}
+	verified := cached.VerificationMethod == GPGDetachedSignatureMethod
+	var mergeID string
+	if verified {
+		mergeID = c.signedFeedID(feedID)
+	}
+	var previous *InstalledFeed
+	if found, err := reg.findFeed(feedURL, mergeID); err == nil {
+		p := *found
+		previous = &p
+	}
+	// Once the previous version is removed, the new version is installed even
+	// if ctx is done, so the feed is never left half installed.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var replaced bool
+	if previous != nil && (previous.ArchivePath != archivePath || (previous.ArchiveSHA256 != "" && previous.ArchiveSHA256 != sum)) {
+		if err := removePreviousInstall(previous, archivePath); err != nil {
 			return err
 		}
-		var nf InstallFile
-		if err := json.Unmarshal(data, &nf); err != nil {
-			return err
+		replaced = true
+	}
+	installDir, err := installArchive(cached)
+	if err != nil {
+		return fmt.Errorf("installation failed: %w", err)
+	}
+
+	installed := InstalledFeed{
+		FeedURL:       feedURL,
+		FeedID:        feedID,
+		Name:          filepath.Base(installDir),
+		ArchivePath:   archivePath,
+		ArchiveSHA256: sum,
+		InstallDir:    installDir,
+		InstalledAt:   time.Now(),
+		Channel:       channel,
+		Pinned:        pinned,
+	}
+	if feed != nil {
+		installed.Name = feed.Name
+		installed.Version = feed.Version
+	} else if previous != nil && previous.ArchivePath == archivePath {
+		installed.Name = previous.Name
+		installed.Version = previous.Version
+		installed.Channel = previous.Channel
+		installed.Pinned = previous.Pinned
+	}
+	if previous != nil && previous.FeedURL != feedURL {
+		reg.remove(previous.FeedURL)
+	}
+	reg.put(installed)
+	if err := reg.save(); err != nil {
+		return fmt.Errorf("failed to record installation: %w", err)
+	}
+	if feed != nil {
+		if err := c.bindFeedID(feedURL, feed, filepath.Dir(archivePath), verified); err != nil {
+			return fmt.Errorf("failed to record the ID of %s: %w", feedURL, err)
 		}
-		for _, p := range nf.Platforms {
-			if p.Name == currentPlatform() {
-				fmt.Fprintf(os.Stderr, "Running %v", p.InstallCommand)
-				cmd := exec.Command(p.InstallCommand[0], p.InstallCommand[1:]...)
-				cmd.Dir = dir
-				cmd.Stdin = os.Stdin
-				cmd.Stderr = os.Stderr
-				cmd.Stdout = os.Stdout
-				if err := cmd.Run(); err != nil {
-					return err
-				}
-				if cmd.ProcessState.ExitCode() != 0 {
-					return fmt.Errorf("process exited with code: %d", cmd.ProcessState.ExitCode())
-				}
-				return nil
-			}
+	}
+	if replaced {
+		if dir := filepath.Dir(previous.ArchivePath); dir != filepath.Dir(archivePath) {
+			c.removeUnusedFeedDir(reg, dir)
+		}
+		if _, err := c.collectGarbage(reg); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove unused archives: %v\n", err)
 		}
-		return fmt.Errorf("cannot install the archive on this platform: %q", currentPlatform())
 	}
+	return nil
+}
 
-	return errors.New("install.json not found")
+// removePreviousInstall runs the upgrade command of a previously installed
+// version and removes its files.
+//
+// The previous archive is kept if it is the archive being installed, which
+// happens when a release is republished with a different archive.
+func removePreviousInstall(previous *InstalledFeed, archivePath string) error {
+	if _, err := os.Stat(previous.InstallDir); err != nil {
+		return nil
+	}
+	if err := upgradeArchive(previous.InstallDir); err != nil {
+		return fmt.Errorf("failed to upgrade %s: %w", previous.InstallDir, err)
+	}
+	if err := os.RemoveAll(previous.InstallDir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", previous.InstallDir, err)
+	}
+	if previous.ArchivePath != archivePath {
+		removeCachedArchive(previous.ArchivePath)
+	}
+	return nil
 }
 
-func fetchFeed(feedURL string) (*Feed, error) {
-	feedData, err := getURL(feedURL)
+// UninstallFeedOptions configures a call to UninstallFeed.
+type UninstallFeedOptions struct {
+	// KeepCache controls whether the feed's cached archive is kept after uninstalling.
+	KeepCache bool
+}
+
+// UninstallFeed uninstalls the archive that was installed from feedURL.
+//
+// feedURL may also be the name of an installed feed.
+func UninstallFeed(ctx context.Context, feedURL string, opts UninstallFeedOptions) error {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return err
+	}
+
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return err
+	}
+
+	installed, err := cache.findInstalled(reg, feedURL)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Uninstalling %s\n", installed.Name)
+	if err := uninstallArchive(installed.InstallDir); err != nil {
+		return fmt.Errorf("uninstallation failed: %w", err)
+	}
+	if err := os.RemoveAll(installed.InstallDir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", installed.InstallDir, err)
+	}
+	if !opts.KeepCache {
+		if err := os.RemoveAll(cache.feedDir(installed.FeedURL)); err != nil {
+			return fmt.Errorf("failed to remove cached feed: %w", err)
+		}
+	}
+
+	reg.remove(installed.FeedURL)
+	if err := reg.save(); err != nil {
+		return fmt.Errorf("failed to record uninstallation: %w", err)
+	}
+	if !opts.KeepCache {
+		if _, err := cache.collectGarbage(reg); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove unused archives: %v\n", err)
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Uninstallation complete!")
+	return nil
+}
+
+// RunFeedOptions configures a call to RunFeed.
+type RunFeedOptions struct {
+	// Stdin is the game's standard input. Defaults to os.Stdin.
+	Stdin io.Reader
+
+	// Stdout is the game's standard output. Defaults to os.Stdout.
+	Stdout io.Writer
+
+	// Stderr is the game's standard error. Defaults to os.Stderr.
+	Stderr io.Writer
+}
+
+// RunFeed runs the software installed from feedURL with args appended to its
+// run command, and returns the exit code of the run command.
+//
+// feedURL may also be the name of an installed feed.
+func RunFeed(ctx context.Context, feedURL string, args []string, opts RunFeedOptions) (int, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return 0, err
+	}
+
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return 0, err
+	}
+
+	installed, err := cache.findInstalled(reg, feedURL)
+	if err != nil {
+		return 0, err
+	}
+
+	platform, err := readInstallPlatform(installed.InstallDir)
+	if err != nil {
+		return 0, err
+	}
+
+	cmd, err := newCommand(ctx, platform.RunCommand, installed.InstallDir, args...)
+	if err != nil {
+		return 0, fmt.Errorf("invalid run command: %w", err)
+	}
+	if opts.Stdin != nil {
+		cmd.Stdin = opts.Stdin
+	}
+	if opts.Stdout != nil {
+		cmd.Stdout = opts.Stdout
+	}
+	if opts.Stderr != nil {
+		cmd.Stderr = opts.Stderr
+	}
+	return runCommand(cmd)
+}
+
+// installArchive extracts a cached archive next to it and runs its install
+// command.
+//
+// It returns the directory the archive was extracted to.
+func installArchive(cached *CachedArchive) (string, error) {
+	dir := removeFileExtension(cached.Path)
+	if _, err := extract(cached.File, cached.Path, dir); err != nil {
+		return "", err
+	}
+	platform, err := readInstallPlatform(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := runInstallCommand(platform.InstallCommand, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// uninstallArchive runs the uninstall command of the archive extracted to dir.
+func uninstallArchive(dir string) error {
+	platform, err := readInstallPlatform(dir)
+	if err != nil {
+		return err
+	}
+	return runInstallCommand(platform.UninstallCommand, dir)
+}
+
+// upgradeArchive runs the upgrade command of the archive extracted to dir.
+//
+// The uninstall command is run if the archive has no upgrade command.
+func upgradeArchive(dir string) error {
+	platform, err := readInstallPlatform(dir)
+	if err != nil {
+		return err
+	}
+	if len(platform.UpgradeCommand) == 0 {
+		return runInstallCommand(platform.UninstallCommand, dir)
+	}
+	return runInstallCommand(platform.UpgradeCommand, dir)
+}
+
+// readInstallPlatform reads the current platform's configuration from the
+// install.json file in the archive extracted to dir.
+func readInstallPlatform(dir string) (*Platform, error) {
+	filename, err := findInstallFile(dir)
 	if err != nil {
 		return nil, err
 	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var nf InstallFile
+	if err := json.Unmarshal(data, &nf); err != nil {
+		return nil, err
+	}
+	var best *Platform
+	bestScore := -1
+	for i := range nf.Platforms {
+		score := matchPlatform(nf.Platforms[i].Name, currentPlatform(), currentArch())
+		if nf.Platforms[i].Name != "" && score > bestScore {
+			best, bestScore = &nf.Platforms[i], score
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("cannot install the archive on this platform: %q", currentPlatform()+"/"+currentArch())
+	}
+	return best, nil
+}
+
+func findInstallFile(dir string) (string, error) {
+	var found string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if found == "" && !info.IsDir() && info.Name() == "install.json" {
+			found = path
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", errors.New("install.json not found")
+	}
+	return found, nil
+}
+
+// runInstallCommand runs one of a Platform's install commands in dir.
+//
+// The command is not stopped by the download timeout or cancellation, which
+// could leave the game half installed: it always runs to completion. Callers
+// check their context before they start changing an installation instead.
+func runInstallCommand(command []string, dir string) error {
+	cmd, err := newCommand(context.Background(), command, dir)
+	if err != nil {
+		return err
+	}
+	code, err := runCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("process exited with code: %d", code)
+	}
+	return nil
+}
+
+// newCommand returns a command that runs command in dir with args appended.
+//
+// The command is connected to this process's standard streams.
+func newCommand(ctx context.Context, command []string, dir string, args ...string) (*exec.Cmd, error) {
+	if len(command) == 0 {
+		return nil, errors.New("the command is empty")
+	}
+	argv := append(append([]string{}, command...), args...)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	return cmd, nil
+}
+
+// runCommand runs cmd and returns its exit code.
+func runCommand(cmd *exec.Cmd) (int, error) {
+	fmt.Fprintf(os.Stderr, "Running %v\n", cmd.Args)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, err
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
+
+func normalizeFeedURL(feedURL string) string {
+	if strings.HasPrefix(feedURL, "file://") {
+		return "file://" + filepath.Clean(feedURL[7:])
+	}
+	return feedURL
+}
+
+// parseFeed parses the feed document fetched from feedURL.
+func parseFeed(feedURL string, feedData []byte) (*Feed, error) {
 	var feed Feed
 	if err := json.Unmarshal(feedData, &feed); err != nil {
 		return nil, err
 	}
+	if err := feed.resolveURLs(feedURL); err != nil {
+		return nil, err
+	}
 	return &feed, nil
 }
 
-func fetchFeedArchive(feed *Feed, method VerificationMethod) ([]byte, error) {
+// resolveURLs makes the archive, signature and mirror URLs of every release,
+// and the URL the feed moved to, absolute by resolving relative URLs against
+// feedURL.
+func (f *Feed) resolveURLs(feedURL string) error {
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return err
+	}
+	if f.MovedTo, err = resolveURL(base, f.MovedTo); err != nil {
+		return err
+	}
+	archives := []*Archive{&f.Archive}
+	for i := range f.Archives {
+		archives = append(archives, &f.Archives[i])
+	}
+	for i := range f.Releases {
+		archives = append(archives, &f.Releases[i].Archive)
+		for j := range f.Releases[i].Archives {
+			archives = append(archives, &f.Releases[i].Archives[j])
+		}
+	}
+	for _, a := range archives {
+		urls := []*string{&a.ArchiveURL, &a.GPGSignatureURL}
+		for i := range a.Mirrors {
+			urls = append(urls, &a.Mirrors[i])
+		}
+		for i := range a.GPGSignatureMirrors {
+			urls = append(urls, &a.GPGSignatureMirrors[i])
+		}
+		for _, u := range urls {
+			if *u, err = resolveURL(base, *u); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveURL resolves ref against base if ref is a relative URL.
+func resolveURL(base *url.URL, ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q in feed: %w", ref, err)
+	}
+	if refURL.IsAbs() {
+		return ref, nil
+	}
+	resolved := base.ResolveReference(refURL)
+	if resolved.Scheme == "file" {
+		// FileFetcher reads the path as it is written, without unescaping.
+		return "file://" + resolved.Path, nil
+	}
+	return resolved.String(), nil
+}
+
+// fetchFeedArchive downloads feed's archive to dst and verifies it using method.
+//
+// The archive must not be used if an error is returned.
+func (d *downloader) fetchFeedArchive(ctx context.Context, feed *Feed, method VerificationMethod, dst *partialFile) (*archiveDownload, error) {
 	switch method {
 	case AutoSelectMethod:
-		method = DoNotVerifyMethod
-		if feed.GPGSignatureURL != "" {
-			method = GPGDetachedSignatureMethod
-		}
-		return fetchFeedArchive(feed, method)
+		return d.fetchFeedArchive(ctx, feed, selectVerificationMethod(feed), dst)
 	case DoNotVerifyMethod:
-		return getURL(feed.ArchiveURL)
+		size, sum, err := d.streamArchive(ctx, &feed.Archive, dst, ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyChecksum(&feed.Archive, size, sum); err != nil {
+			return nil, err
+		}
+		return &archiveDownload{method: method, size: size, sha256: sum}, nil
 	case GPGDetachedSignatureMethod:
-		return verifyFeedWithDetachedSignature(feed)
+		return d.verifyFeedWithDetachedSignature(ctx, feed, dst)
+	case ChecksumMethod:
+		return d.verifyFeedWithChecksum(ctx, feed, dst)
 	}
 	return nil, fmt.Errorf("unsupported verification method: %v", method)
 }
 
-func verifyFeedWithDetachedSignature(feed *Feed) ([]byte, error) {
-	data, err := getURL(feed.ArchiveURL)
-	if err != nil {
-		return nil, fmt.Errorf("feed archive URL is invalid: %w", err)
+// selectVerificationMethod returns the strongest verification method feed
+// supports. Feeds with a signing key must be verified with it.
+func selectVerificationMethod(feed *Feed) VerificationMethod {
+	if feed.GPGSignatureURL != "" || feed.SigningKey != "" {
+		return GPGDetachedSignatureMethod
 	}
-	signature, err := getURL(feed.GPGSignatureURL)
+	if feed.ArchiveSHA256 != "" {
+		return ChecksumMethod
+	}
+	return DoNotVerifyMethod
+}
+
+// archiveDownload describes a downloaded archive and how it was verified.
+type archiveDownload struct {
+	method    VerificationMethod
+	size      int64
+	sha256    []byte
+	signature []byte
+}
+
+func (d *downloader) verifyFeedWithDetachedSignature(ctx context.Context, feed *Feed, dst *partialFile) (*archiveDownload, error) {
+	signature, err := d.getMirrorURL(ctx, feed.signatureURLs())
 	if err != nil {
 		return nil, fmt.Errorf("feed gpg signature URL is invalid: %w", err)
 	}
-	if err := verifyDetachedSignature(data, signature); err != nil {
+	keyRing, err := readFeedKeyRing(feed)
+	if err != nil {
 		return nil, err
 	}
-	return data, nil
-}
 
-func verifyDetachedSignature(data, signature []byte) error {
-	keyRing, err := readDefaultKeyRing()
+	// Verify the signature while the archive is downloaded.
+	pr, pw := io.Pipe()
+	verified := make(chan error, 1)
+	go func() {
+		err := verifyDetachedSignature(keyRing, pr, signature)
+		pr.CloseWithError(errVerificationStopped)
+		verified <- err
+	}()
+	size, sum, err := d.streamArchive(ctx, &feed.Archive, dst, pw)
+	pw.CloseWithError(err)
+	verifyErr := <-verified
+	if errors.Is(err, errVerificationStopped) && verifyErr != nil {
+		// The signature was rejected before the whole archive was read, which
+		// stopped the download.
+		return nil, verifyErr
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, pgpPublicKey := range keyRing.GetKeys() {
-		fmt.Fprintln(os.Stderr, "Verifying feed signature...")
-		message := crypto.NewPlainMessage(data)
-		signature := crypto.NewPGPSignature(signature)
-		if err != nil {
-			return err
-		}
-		keyRing, err := crypto.NewKeyRing(pgpPublicKey)
-		if err != nil {
-			return err
-		}
-		if keyRing.VerifyDetached(message, signature, crypto.GetUnixTime()) == nil {
-			fmt.Fprintln(os.Stderr, "Feed signature verified")
-			return nil
-		}
+	if verifyErr != nil {
+		return nil, verifyErr
 	}
-	return fmt.Errorf("feed signature could not be verified: %w", err)
+	if err := verifyChecksum(&feed.Archive, size, sum); err != nil {
+		return nil, err
+	}
+	return &archiveDownload{method: GPGDetachedSignatureMethod, size: size, sha256: sum, signature: signature}, nil
+}
+
+// errVerificationStopped is returned when an archive is written to a
+// signature verifier that has already finished.
+var errVerificationStopped = errors.New("signature verification finished before the end of the archive")
+
+func verifyDetachedSignature(keyRing *crypto.KeyRing, data io.Reader, signature []byte) error {
+	fmt.Fprintln(os.Stderr, "Verifying feed signature...")
+	if err := keyRing.VerifyDetachedStream(data, crypto.NewPGPSignature(signature), crypto.GetUnixTime()); err != nil {
+		return fmt.Errorf("feed signature could not be verified: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "Feed signature verified")
+	return nil
 }
@@ -0,0 +1,160 @@
+package zerogame
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// newTestKey generates a GPG key for signing test archives.
+func newTestKey(t *testing.T, name string) *crypto.Key {
+	t.Helper()
+	key, err := crypto.GenerateKey(name, name+"@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signDetached returns the detached signature of data by key.
+func signDetached(t *testing.T, key *crypto.Key, data []byte) []byte {
+	t.Helper()
+	keyRing, err := crypto.NewKeyRing(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := keyRing.SignDetached(crypto.NewPlainMessage(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature.GetBinary()
+}
+
+// useTestKeyRing makes keys the user's GPG key ring for the rest of the test.
+func useTestKeyRing(t *testing.T, keys ...*crypto.Key) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	var pubring []byte
+	for _, key := range keys {
+		public, err := key.GetPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubring = append(pubring, public...)
+	}
+	if err := os.MkdirAll(filepath.Join(home, gpgKeyDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, gpgKeyDir, keyRingPaths[0]), pubring, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestPartialFile returns an empty partial file to download an archive to.
+func newTestPartialFile(t *testing.T) *partialFile {
+	t.Helper()
+	fd, err := os.Create(filepath.Join(t.TempDir(), "game.zip.part"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fd.Close() })
+	return &partialFile{File: fd}
+}
+
+func TestFetchFeedArchiveRejectsSignatureByUnknownKey(t *testing.T) {
+	trusted, other := newTestKey(t, "trusted"), newTestKey(t, "other")
+	useTestKeyRing(t, trusted)
+
+	archive := []byte(strings.Repeat("archive contents ", 4096))
+	signature := signDetached(t, other, archive)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/game.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	mux.HandleFunc("/game.zip.sig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(signature)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	feed := &Feed{Release: Release{Archive: Archive{
+		ArchiveURL:      server.URL + "/game.zip",
+		GPGSignatureURL: server.URL + "/game.zip.sig",
+	}}}
+	d := newDownloader(FetchOptions{}, nil)
+	_, err := d.fetchFeedArchive(context.Background(), feed, GPGDetachedSignatureMethod, newTestPartialFile(t))
+	if err == nil {
+		t.Fatal("fetchFeedArchive() succeeded, want a signature error")
+	}
+	var interrupted *interruptedError
+	if errors.As(err, &interrupted) {
+		t.Fatalf("fetchFeedArchive() = %v, want an error that is not resumable", err)
+	}
+	if !strings.Contains(err.Error(), "signature could not be verified") {
+		t.Fatalf("fetchFeedArchive() = %v, want a signature error", err)
+	}
+}
+
+func TestFetchFeedArchiveAcceptsSignatureByKnownKey(t *testing.T) {
+	trusted := newTestKey(t, "trusted")
+	useTestKeyRing(t, trusted)
+
+	archive := []byte(strings.Repeat("archive contents ", 4096))
+	signature := signDetached(t, trusted, archive)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/game.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	mux.HandleFunc("/game.zip.sig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(signature)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	feed := &Feed{Release: Release{Archive: Archive{
+		ArchiveURL:      server.URL + "/game.zip",
+		GPGSignatureURL: server.URL + "/game.zip.sig",
+	}}}
+	d := newDownloader(FetchOptions{}, nil)
+	dl, err := d.fetchFeedArchive(context.Background(), feed, GPGDetachedSignatureMethod, newTestPartialFile(t))
+	if err != nil {
+		t.Fatalf("fetchFeedArchive() = %v", err)
+	}
+	if dl.size != int64(len(archive)) {
+		t.Errorf("downloaded %d bytes, want %d", dl.size, len(archive))
+	}
+}
+
+func TestInstallFeedRunsInstallCommandAfterTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	marker := filepath.Join(t.TempDir(), "installed")
+	s := newTestArchiveServer(t, newTestInstallArchive(t, Platform{
+		InstallCommand:   []string{"sh", "-c", "sleep 0.5 && touch " + marker},
+		UninstallCommand: []string{"true"},
+	}))
+	feedURL := s.addFeed(t, "/game/feed.json", "", nil)
+
+	// The timeout expires while the install command runs.
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if err := InstallFeed(ctx, feedURL, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("the install command was stopped: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package zerogame
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	feedDocumentName = "feed.json"
+	feedMetaName     = "feed.meta.json"
+)
+
+// feedMeta records how the cached feed document was fetched.
+type feedMeta struct {
+	// URL is the feed URL the document was fetched from.
+	URL string `json:"url"`
+
+	// ETag and LastModified are the validators the server sent with the
+	// document. They are sent back when the feed is refreshed.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// FetchedAt is when the document was last fetched or found unchanged.
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// fetchFeed fetches the feed at feedURL and stores the document in the cache.
+//
+// If the cache has a copy of the feed, the request is conditional and the
+// cached copy is used when the server reports that the feed has not changed.
+func (c cache) fetchFeed(ctx context.Context, d *downloader, feedURL string) (*Feed, error) {
+	data, meta := c.readCachedFeed(feedURL)
+	req := &FetchRequest{URL: feedURL}
+	if data != nil && meta.URL == feedURL {
+		req.IfNoneMatch = meta.ETag
+		req.IfModifiedSince = meta.LastModified
+	}
+
+	var fetched []byte
+	var notModified bool
+	err := d.retry(ctx, feedURL, func() error {
+		res, err := d.fetch(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if notModified = res.NotModified; notModified {
+			return nil
+		}
+		meta = feedMeta{URL: feedURL, ETag: res.ETag, LastModified: res.LastModified}
+		fetched, err = ioutil.ReadAll(res.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if notModified {
+		fmt.Fprintf(os.Stderr, "Feed %s has not changed\n", feedURL)
+	} else {
+		if isHTML(fetched) {
+			return nil, &HTMLResponseError{URL: feedURL}
+		}
+		data = fetched
+	}
+	feed, err := parseFeed(feedURL, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkFeedIdentity(feedURL, feed); err != nil {
+		return nil, err
+	}
+	meta.FetchedAt = time.Now()
+	if err := c.writeCachedFeed(feedURL, data, meta); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to cache feed %s: %v\n", feedURL, err)
+	}
+	return feed, nil
+}
+
+// readCachedFeed returns the cached document of feedURL and how it was
+// fetched, or nil if the feed is not cached.
+//
+// If the feed has an ID, the document may have been fetched from another of
+// the feed's URLs.
+func (c cache) readCachedFeed(feedURL string) ([]byte, feedMeta) {
+	var meta feedMeta
+	metaData, err := ioutil.ReadFile(filepath.Join(c.feedDir(feedURL), feedMetaName))
+	if err != nil || json.Unmarshal(metaData, &meta) != nil || meta.URL == "" {
+		return nil, feedMeta{}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(c.feedDir(feedURL), feedDocumentName))
+	if err != nil {
+		return nil, feedMeta{}
+	}
+	return data, meta
+}
+
+func (c cache) writeCachedFeed(feedURL string, data []byte, meta feedMeta) error {
+	c.ensureFeedDir(feedURL)
+	metaData, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(c.feedDir(feedURL), feedDocumentName), data, 0644); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.feedDir(feedURL), feedMetaName), metaData, 0644)
+}
+
+// cachedArchiveMatches reports whether the cached archive of feedURL is the
+// archive of feed's release, so it does not need to be downloaded again.
+//
+// The archive must have the release's name and version, and its size and
+// hash if the feed has them.
+func (c cache) cachedArchiveMatches(feedURL string, feed *Feed) bool {
+	cached, err := c.GetFeedArchive(feedURL)
+	if err != nil || filepath.Base(cached.Path) != feedArchiveName(feed) {
+		return false
+	}
+	if feed.ArchiveSize > 0 {
+		if info, err := os.Stat(cached.File); err != nil || info.Size() != feed.ArchiveSize {
+			return false
+		}
+	}
+	if feed.ArchiveSHA256 != "" {
+		sum, err := cached.sha256()
+		if err != nil || !strings.EqualFold(sum, feed.ArchiveSHA256) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,466 @@
+package zerogame
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetryBackoff is the delay before the first retry of a failed request.
+const DefaultRetryBackoff = time.Second
+
+// maxRetryBackoff limits the delay between two retries.
+const maxRetryBackoff = time.Minute
+
+// ErrRequestTimeout is returned when a request receives no data for longer
+// than FetchOptions.RequestTimeout.
+var ErrRequestTimeout = errors.New("request timed out")
+
+// FetchOptions configures how feeds, archives and signatures are fetched.
+//
+// The overall time spent fetching is limited by the context passed to
+// InstallFeed or UpdateFeeds.
+type FetchOptions struct {
+	// RequestTimeout is how long a request may wait for a response or for more
+	// data before it fails with ErrRequestTimeout.
+	//
+	// Zero means requests never time out.
+	RequestTimeout time.Duration
+
+	// Retries is how many times a request that failed with a transient error,
+	// such as a timeout or a 5xx status code, is retried.
+	//
+	// Interrupted archive downloads are resumed when possible.
+	Retries int
+
+	// RetryBackoff is the delay before the first retry. It doubles after every
+	// retry.
+	//
+	// Defaults to DefaultRetryBackoff.
+	RetryBackoff time.Duration
+
+	// MirrorOrder chooses the order in which the mirrors of an archive are
+	// tried.
+	MirrorOrder MirrorOrder
+}
+
+// Fetcher fetches the contents of URLs with a particular scheme.
+//
+// Fetchers are registered for a scheme using RegisterFetcher. Timeouts and
+// retries are handled by the caller, so a Fetcher only needs to make a single
+// attempt and stop when ctx is done.
+type Fetcher interface {
+	// Fetch opens the contents of req.URL.
+	//
+	// Fetch returns an *HTTPError, or an error wrapping one, if the server
+	// responded with a status code that should be retried, such as 503.
+	Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error)
+}
+
+// FetchRequest is a request for the contents of a URL.
+type FetchRequest struct {
+	// URL is the URL to fetch.
+	URL string
+
+	// Offset is the position in the contents to start reading from.
+	//
+	// A Fetcher that cannot start reading at Offset returns the contents from
+	// the start and sets FetchResponse.Offset to zero.
+	Offset int64
+
+	// Length is the number of bytes to read from Offset, or zero to read the
+	// contents to the end. It is a hint: a Fetcher may return more.
+	Length int64
+
+	// IfRange is the ETag or Last-Modified time of the contents that were
+	// partially read before.
+	//
+	// If set, Offset is only honored if the contents still have this ETag or
+	// Last-Modified time.
+	IfRange string
+
+	// IfNoneMatch and IfModifiedSince are the ETag and Last-Modified time of
+	// a previously fetched copy of the contents.
+	//
+	// If the contents have not changed since, the Fetcher may return a
+	// response with NotModified set instead of the contents.
+	IfNoneMatch     string
+	IfModifiedSince string
+}
+
+// FetchResponse is the opened contents of a URL.
+type FetchResponse struct {
+	// Body reads the contents of the URL starting at Offset.
+	Body io.ReadCloser
+
+	// Offset is the position of Body's first byte in the contents.
+	Offset int64
+
+	// Size is the size of the entire contents, or -1 if it is unknown.
+	Size int64
+
+	// ETag and LastModified identify the version of the contents, if known.
+	//
+	// LastModified uses the HTTP date format.
+	ETag         string
+	LastModified string
+
+	// NotModified is set if the contents have not changed since the copy
+	// identified by FetchRequest.IfNoneMatch or IfModifiedSince. Body is then
+	// empty.
+	NotModified bool
+}
+
+var fetchers = struct {
+	sync.RWMutex
+	schemes map[string]Fetcher
+}{schemes: make(map[string]Fetcher)}
+
+// RegisterFetcher registers f to fetch URLs with the given scheme, replacing
+// any Fetcher registered for it before.
+func RegisterFetcher(scheme string, f Fetcher) {
+	fetchers.Lock()
+	defer fetchers.Unlock()
+	fetchers.schemes[strings.ToLower(scheme)] = f
+}
+
+// LookupFetcher returns the Fetcher registered for scheme.
+func LookupFetcher(scheme string) (Fetcher, bool) {
+	fetchers.RLock()
+	defer fetchers.RUnlock()
+	f, ok := fetchers.schemes[strings.ToLower(scheme)]
+	return f, ok
+}
+
+// FetcherSchemes returns the schemes that have a registered Fetcher in
+// alphabetical order.
+func FetcherSchemes() []string {
+	fetchers.RLock()
+	defer fetchers.RUnlock()
+	var schemes []string
+	for scheme := range fetchers.schemes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// HTTPError is returned when an HTTP request fails with a non-2xx status code.
+type HTTPError struct {
+	// URL is the requested URL.
+	URL string
+
+	// StatusCode is the response's status code.
+	StatusCode int
+
+	// Status is the response's status line, such as "404 Not Found".
+	Status string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("GET %s failed: %s", e.URL, e.Status)
+}
+
+// HTMLResponseError is returned when a URL returns an HTML page instead of
+// the expected feed, archive or signature.
+//
+// This usually means the URL points to a login, preview or error page rather
+// than to the file itself.
+type HTMLResponseError struct {
+	// URL is the requested URL.
+	URL string
+}
+
+func (e *HTMLResponseError) Error() string {
+	return fmt.Sprintf("GET %s returned an HTML page instead of a file. make sure the URL downloads the file directly", e.URL)
+}
+
+// sniffLen is the number of bytes used to detect HTML responses.
+const sniffLen = 512
+
+// downloader fetches feeds, archives and signatures.
+type downloader struct {
+	opts     FetchOptions
+	progress ProgressFunc
+}
+
+func newDownloader(opts FetchOptions, progress ProgressFunc) *downloader {
+	return &downloader{opts: opts, progress: progress}
+}
+
+// getURL reads the entire contents of u.
+//
+// It is used for small files such as feeds and signatures. Archives are
+// streamed using openURL instead.
+func (d *downloader) getURL(ctx context.Context, u string) ([]byte, error) {
+	var data []byte
+	err := d.retry(ctx, u, func() error {
+		res, err := d.openURL(ctx, u, 0, "")
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		data, err = ioutil.ReadAll(res.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isHTML(data) {
+		return nil, &HTMLResponseError{URL: u}
+	}
+	return data, nil
+}
+
+// CheckURL checks that u can be fetched by opening it and reading its first
+// bytes, the way feeds, archives and signatures are fetched.
+func CheckURL(ctx context.Context, u string, opts FetchOptions) error {
+	d := newDownloader(opts, nil)
+	return d.retry(ctx, u, func() error {
+		res, err := d.openURL(ctx, u, 0, "")
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(res.Body, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if isHTML(head[:n]) {
+			return &HTMLResponseError{URL: u}
+		}
+		return nil
+	})
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or has been retried d.opts.Retries times.
+func (d *downloader) retry(ctx context.Context, u string, fn func() error) error {
+	backoff := d.opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= d.opts.Retries || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Fetching %s failed: %v. Retrying in %v (%d/%d)\n", u, err, backoff, attempt+1, d.opts.Retries)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// isTransient reports whether a request that failed with err may succeed if
+// it is retried.
+func isTransient(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		wrongHost        x509.HostnameError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) || errors.As(err, &wrongHost) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, ErrRequestTimeout) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// maxConfirmPageSize limits the size of the HTML pages read to confirm a
+// download.
+const maxConfirmPageSize = 1 << 20
+
+// openURL opens u for reading starting at offset using the Fetcher
+// registered for its scheme.
+//
+// Share links are rewritten to download URLs using the registered
+// URLRewriters. See FetchRequest for the meaning of offset and ifRange.
+func (d *downloader) openURL(ctx context.Context, u string, offset int64, ifRange string) (*FetchResponse, error) {
+	return d.fetch(ctx, &FetchRequest{URL: u, Offset: offset, IfRange: ifRange})
+}
+
+// fetch sends req to the Fetcher registered for the scheme of req.URL.
+func (d *downloader) fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+	u := RewriteURL(req.URL)
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, ok := LookupFetcher(parsedURL.Scheme)
+	if !ok {
+		return nil, fmt.Errorf("invalid scheme: %q. must be one of: %v ", u, FetcherSchemes())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	watchdog := newWatchdog(d.opts.RequestTimeout, cancel)
+	rewritten := *req
+	rewritten.URL = u
+	req = &rewritten
+	res, err := fetcher.Fetch(ctx, req)
+	if err == nil && res.Offset == 0 && !res.NotModified {
+		res, err = confirmResponse(ctx, fetcher, req, res)
+	}
+	if err != nil {
+		watchdog.stop()
+		return nil, watchdog.wrap(u, err)
+	}
+	res.Body = &watchdogReader{
+		ReadCloser: &contextReader{ctx: ctx, ReadCloser: res.Body},
+		watchdog:   watchdog,
+		url:        u,
+	}
+	return res, nil
+}
+
+// confirmResponse follows the confirmation step of hosts that return an HTML
+// page instead of the file for some downloads.
+//
+// res is returned with its contents intact if it is not a confirmation page.
+func confirmResponse(ctx context.Context, fetcher Fetcher, req *FetchRequest, res *FetchResponse) (*FetchResponse, error) {
+	br := bufio.NewReader(res.Body)
+	body := struct {
+		io.Reader
+		io.Closer
+	}{br, res.Body}
+	if head, _ := br.Peek(sniffLen); !isHTML(head) {
+		res.Body = body
+		return res, nil
+	}
+	page, err := ioutil.ReadAll(io.LimitReader(br, maxConfirmPageSize))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	confirmed, ok := confirmDownload(req.URL, page)
+	if !ok {
+		body.Reader = io.MultiReader(bytes.NewReader(page), br)
+		res.Body = body
+		return res, nil
+	}
+	res.Body.Close()
+	return fetcher.Fetch(ctx, &FetchRequest{URL: confirmed, Offset: req.Offset, IfRange: req.IfRange})
+}
+
+// watchdog cancels a request that receives no data for longer than a timeout.
+type watchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func newWatchdog(timeout time.Duration, cancel context.CancelFunc) *watchdog {
+	w := &watchdog{timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		w.timer = time.AfterFunc(timeout, func() {
+			w.mu.Lock()
+			w.expired = true
+			w.mu.Unlock()
+			cancel()
+		})
+	}
+	return w
+}
+
+// reset restarts the timeout after data was received.
+func (w *watchdog) reset() {
+	if w.timer != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *watchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.cancel()
+}
+
+// wrap returns ErrRequestTimeout if err was caused by the watchdog.
+func (w *watchdog) wrap(u string, err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired {
+		return fmt.Errorf("%w: no data received from %s for %v", ErrRequestTimeout, u, w.timeout)
+	}
+	return err
+}
+
+// watchdogReader resets a watchdog whenever data is read.
+type watchdogReader struct {
+	io.ReadCloser
+	watchdog *watchdog
+	url      string
+}
+
+func (r *watchdogReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.watchdog.reset()
+	}
+	if err != nil && err != io.EOF {
+		err = r.watchdog.wrap(r.url, err)
+	}
+	return n, err
+}
+
+func (r *watchdogReader) Close() error {
+	r.watchdog.stop()
+	return r.ReadCloser.Close()
+}
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// isHTML reports whether data, or the first sniffLen bytes of a file, looks
+// like an HTML document.
+//
+// Feeds, archives and signatures are never HTML.
+func isHTML(data []byte) bool {
+	return strings.HasPrefix(http.DetectContentType(data), "text/html")
+}
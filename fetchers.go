@@ -0,0 +1,222 @@
+package zerogame
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterFetcher("file", FileFetcher{})
+	RegisterFetcher("http", &HTTPFetcher{})
+	RegisterFetcher("https", &HTTPFetcher{})
+}
+
+// FileFetcher fetches file:// URLs from the local filesystem.
+type FileFetcher struct{}
+
+// Fetch implements Fetcher.
+func (FileFetcher) Fetch(_ context.Context, req *FetchRequest) (*FetchResponse, error) {
+	fd, err := os.Open(strings.TrimPrefix(req.URL, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	res := &FetchResponse{
+		Body:         fd,
+		Size:         info.Size(),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}
+	if req.IfModifiedSince != "" && req.IfModifiedSince == res.LastModified {
+		fd.Close()
+		res.Body = http.NoBody
+		res.NotModified = true
+		return res, nil
+	}
+	if req.Offset > 0 && req.Offset <= res.Size && (req.IfRange == "" || req.IfRange == res.LastModified) {
+		if _, err := fd.Seek(req.Offset, io.SeekStart); err != nil {
+			fd.Close()
+			return nil, err
+		}
+		res.Offset = req.Offset
+	}
+	return res, nil
+}
+
+// maxRedirects is the number of redirects HTTPFetcher follows, whatever the
+// CheckRedirect function of its client.
+const maxRedirects = 10
+
+// HTTPFetcher fetches http:// and https:// URLs.
+type HTTPFetcher struct {
+	// Client sends the requests.
+	//
+	// Defaults to DefaultHTTPClient.
+	Client *http.Client
+
+	// Credentials chooses the credentials sent with each request.
+	//
+	// Defaults to DefaultCredentials. Credentials are only sent to the host
+	// of the requested URL, never after a redirect to a different host or
+	// from https to http.
+	Credentials CredentialSource
+}
+
+// Fetch implements Fetcher.
+func (f *HTTPFetcher) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
+	client := f.Client
+	if client == nil {
+		var err error
+		if client, err = DefaultHTTPClient(); err != nil {
+			return nil, err
+		}
+	}
+	c := *client
+	client = &c
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		stripCrossHostCredentials(r, via)
+		if checkRedirect != nil {
+			return checkRedirect(r, via)
+		}
+		return nil
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.authorize(ctx, httpReq); err != nil {
+		return nil, err
+	}
+	if req.Length > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", req.Offset, req.Offset+req.Length-1))
+	} else if req.Offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", req.Offset))
+	}
+	if req.Offset > 0 {
+		if req.IfRange != "" {
+			httpReq.Header.Set("If-Range", req.IfRange)
+		}
+	}
+	if req.IfNoneMatch != "" {
+		httpReq.Header.Set("If-None-Match", req.IfNoneMatch)
+	}
+	if req.IfModifiedSince != "" {
+		httpReq.Header.Set("If-Modified-Since", req.IfModifiedSince)
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified && (req.IfNoneMatch != "" || req.IfModifiedSince != "") {
+		res.Body.Close()
+		return &FetchResponse{
+			Body:         http.NoBody,
+			Size:         -1,
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			NotModified:  true,
+		}, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, &HTTPError{URL: req.URL, StatusCode: res.StatusCode, Status: res.Status}
+	}
+	r := &FetchResponse{
+		Body:         res.Body,
+		Size:         res.ContentLength,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	if res.StatusCode == http.StatusPartialContent {
+		start, size, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok {
+			res.Body.Close()
+			return nil, fmt.Errorf("GET %s returned an invalid Content-Range: %q", req.URL, res.Header.Get("Content-Range"))
+		}
+		r.Offset, r.Size = start, size
+	}
+	return r, nil
+}
+
+// authorize adds the credential for the request's host, if any.
+func (f *HTTPFetcher) authorize(ctx context.Context, req *http.Request) error {
+	source := f.Credentials
+	if source == nil {
+		var err error
+		if source, err = DefaultCredentials(); err != nil {
+			return err
+		}
+	}
+	cred, err := source.Credential(ctx, req.URL)
+	if err != nil || cred == nil {
+		return err
+	}
+	if cred.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cred.Token)
+	} else if cred.Username != "" || cred.Password != "" {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+	return nil
+}
+
+// stripCrossHostCredentials removes the credentials from a redirected request
+// once any request in the chain has left the original host, so they are not
+// sent to the new host nor to the original host again. They are also removed
+// when an https request is redirected to http.
+func stripCrossHostCredentials(r *http.Request, via []*http.Request) {
+	if isSecure(via[0].URL) && !isSecure(r.URL) {
+		r.Header.Del("Authorization")
+		return
+	}
+	host := via[0].URL.Host
+	for _, prev := range via[1:] {
+		if !strings.EqualFold(prev.URL.Host, host) {
+			r.Header.Del("Authorization")
+			return
+		}
+	}
+	if !strings.EqualFold(r.URL.Host, host) {
+		r.Header.Del("Authorization")
+	}
+}
+
+// parseContentRange parses a Content-Range header such as "bytes 100-199/200"
+// and returns the first byte position and the complete length, which is -1
+// if it is unknown.
+func parseContentRange(header string) (start, size int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	i := strings.IndexByte(parts[0], '-')
+	if i < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(parts[0][:i], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size = -1
+	if parts[1] != "*" {
+		if size, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
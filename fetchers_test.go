@@ -0,0 +1,149 @@
+package zerogame
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestHTTPFetcher(t *testing.T, credentials CredentialSource) *HTTPFetcher {
+	t.Helper()
+	client, err := NewHTTPClient(NetworkConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &HTTPFetcher{Client: client, Credentials: credentials}
+}
+
+func TestHTTPFetcherStopsRedirectLoops(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	// A regression would follow the redirects forever.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	f := newTestHTTPFetcher(t, CredentialChain{})
+	res, err := f.Fetch(ctx, &FetchRequest{URL: server.URL + "/feed.json"})
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("Fetch() succeeded, want a redirect error")
+	}
+	if !strings.Contains(err.Error(), "stopped after 10 redirects") {
+		t.Errorf("Fetch() = %v, want a redirect error", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != maxRedirects {
+		t.Errorf("server received %d requests, want %d", requests, maxRedirects)
+	}
+}
+
+func TestHTTPFetcherDoesNotSendCredentialsToOtherHosts(t *testing.T) {
+	var mu sync.Mutex
+	var otherAuth []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		otherAuth = append(otherAuth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Write([]byte("archive"))
+	}))
+	defer other.Close()
+	var originAuth string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		originAuth = r.Header.Get("Authorization")
+		mu.Unlock()
+		http.Redirect(w, r, other.URL+"/game.zip", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	originURL, _ := url.Parse(origin.URL)
+	f := newTestHTTPFetcher(t, HostCredentials{{Host: originURL.Host, AllowHTTP: true, Credential: Credential{Token: "secret"}}})
+	res, err := f.Fetch(context.Background(), &FetchRequest{URL: origin.URL + "/game.zip"})
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	}
+	res.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if originAuth != "Bearer secret" {
+		t.Errorf("origin received Authorization %q, want %q", originAuth, "Bearer secret")
+	}
+	if len(otherAuth) != 1 || otherAuth[0] != "" {
+		t.Errorf("other host received Authorization %q, want none", otherAuth)
+	}
+}
+
+func TestStripCrossHostCredentials(t *testing.T) {
+	newRequest := func(u string) *http.Request {
+		r, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Authorization", "Bearer secret")
+		return r
+	}
+	tests := []struct {
+		name     string
+		chain    []string
+		wantAuth bool
+	}{
+		{
+			name:     "same host",
+			chain:    []string{"https://a.example.com/feed.json", "https://a.example.com/v2/feed.json"},
+			wantAuth: true,
+		},
+		{
+			name:     "same host with different case",
+			chain:    []string{"https://a.example.com/feed.json", "https://A.Example.com/v2/feed.json"},
+			wantAuth: true,
+		},
+		{
+			name:  "other host",
+			chain: []string{"https://a.example.com/feed.json", "https://b.example.com/feed.json"},
+		},
+		{
+			name:  "other port",
+			chain: []string{"https://a.example.com/feed.json", "https://a.example.com:8443/feed.json"},
+		},
+		{
+			name:  "back to the original host",
+			chain: []string{"https://a.example.com/feed.json", "https://b.example.com/feed.json", "https://a.example.com/feed.json"},
+		},
+		{
+			name:  "https to http",
+			chain: []string{"https://a.example.com/feed.json", "http://a.example.com/feed.json"},
+		},
+		{
+			name:     "http allowed by the original request",
+			chain:    []string{"http://a.example.com/feed.json", "http://a.example.com/v2/feed.json"},
+			wantAuth: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var via []*http.Request
+			for _, u := range tt.chain[:len(tt.chain)-1] {
+				via = append(via, newRequest(u))
+			}
+			r := newRequest(tt.chain[len(tt.chain)-1])
+			stripCrossHostCredentials(r, via)
+			if got := r.Header.Get("Authorization") != ""; got != tt.wantAuth {
+				t.Errorf("Authorization kept = %v, want %v", got, tt.wantAuth)
+			}
+		})
+	}
+}
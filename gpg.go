@@ -50,6 +50,36 @@ func readDefaultKeyRing() (*crypto.KeyRing, error) {
 	return readKeyRing(keyRingFile)
 }
 
+// readFeedKeyRing returns the keys that may sign the archives of feed: the
+// key named by feed.SigningKey, or else every key in the default key ring.
+func readFeedKeyRing(feed *Feed) (*crypto.KeyRing, error) {
+	keyRing, err := readDefaultKeyRing()
+	if err != nil || feed.SigningKey == "" {
+		return keyRing, err
+	}
+	for _, key := range keyRing.GetKeys() {
+		if sameKey(key.GetFingerprint(), feed.SigningKey) {
+			return crypto.NewKeyRing(key)
+		}
+	}
+	return nil, fmt.Errorf("the feed's signing key %s is not in your GPG keyring", feed.SigningKey)
+}
+
+// sameKey reports whether a and b are the fingerprint or long key ID of the
+// same GPG key.
+func sameKey(a, b string) bool {
+	a, b = normalizeKeyID(a), normalizeKeyID(b)
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	return len(b) >= 16 && strings.HasSuffix(a, b)
+}
+
+func normalizeKeyID(s string) string {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	return strings.TrimPrefix(s, "0x")
+}
+
 func readKeyRing(filename string) (*crypto.KeyRing, error) {
 	fmt.Fprintln(os.Stderr, "Loading keyring from "+filename)
 	fd, err := os.Open(filename)
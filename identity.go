@@ -0,0 +1,299 @@
+package zerogame
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+const (
+	identitiesName = "feed_ids.json"
+
+	// maxFeedMoves is how many moved_to redirects are followed.
+	maxFeedMoves = 5
+)
+
+// ErrFeedIdentity is returned when a feed claims the ID of a different feed.
+var ErrFeedIdentity = errors.New("feed identity mismatch")
+
+// feedIdentity records the URLs a feed with an ID was installed from.
+//
+// These URLs share the feed's cache directory, Dir.
+type feedIdentity struct {
+	// ID is the feed's ID.
+	ID string `json:"id"`
+
+	// SigningKey is the key the feed's archives were first verified with.
+	// Feeds with a different signing key cannot use the ID.
+	SigningKey string `json:"signing_key,omitempty"`
+
+	// Dir is the name of the feed's cache directory: the directory it was
+	// last installed from.
+	Dir string `json:"dir,omitempty"`
+
+	// URL is the feed's canonical URL: the last URL it was fetched from that
+	// did not announce a move.
+	URL string `json:"url"`
+
+	// URLs lists every URL the feed was installed from.
+	URLs []string `json:"urls"`
+}
+
+// dir returns the name of the cache directory of the feed.
+func (ident *feedIdentity) dir() string {
+	if ident.Dir != "" {
+		return ident.Dir
+	}
+	// Identities recorded by older versions of zerogame use a directory
+	// named after the ID.
+	return feedIDDirName(ident.ID)
+}
+
+// identities records the feed IDs seen on this machine.
+type identities struct {
+	filename string
+	loaded   bool
+
+	Feeds []feedIdentity `json:"feeds"`
+}
+
+// loadIdentities returns the feed IDs seen on this machine. They are read
+// once per cache.
+func (c cache) loadIdentities() (*identities, error) {
+	x := c.identities
+	if x.loaded {
+		return x, nil
+	}
+	data, err := ioutil.ReadFile(x.filename)
+	if os.IsNotExist(err) {
+		x.loaded = true
+		return x, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", x.filename, err)
+	}
+	if err := json.Unmarshal(data, x); err != nil {
+		x.Feeds = nil
+		return nil, fmt.Errorf("failed to parse %s: %w", x.filename, err)
+	}
+	x.loaded = true
+	return x, nil
+}
+
+func (x *identities) save() error {
+	data, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	ensureDir(filepath.Dir(x.filename))
+	return writeFileAtomic(x.filename, data, 0644)
+}
+
+// byURL returns the identity of the feed at feedURL, or nil if it has none.
+func (x *identities) byURL(feedURL string) *feedIdentity {
+	for i := range x.Feeds {
+		if x.Feeds[i].hasURL(feedURL) {
+			return &x.Feeds[i]
+		}
+	}
+	return nil
+}
+
+func (x *identities) byID(id string) *feedIdentity {
+	for i := range x.Feeds {
+		if x.Feeds[i].ID == id {
+			return &x.Feeds[i]
+		}
+	}
+	return nil
+}
+
+func (ident *feedIdentity) hasURL(feedURL string) bool {
+	for _, u := range ident.URLs {
+		if u == feedURL {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error wrapping ErrFeedIdentity if feed, fetched from
+// feedURL, does not match the feed IDs seen before: the feed at feedURL had a
+// different ID, or feed's ID was seen with a different signing key.
+func (x *identities) check(feedURL string, feed *Feed) error {
+	if previous := x.byURL(feedURL); previous != nil && previous.ID != feed.ID {
+		return fmt.Errorf("%w: feed %s changed its ID from %q to %q", ErrFeedIdentity, feedURL, previous.ID, feed.ID)
+	}
+	if feed.ID == "" {
+		return nil
+	}
+	if ident := x.byID(feed.ID); ident != nil && ident.SigningKey != "" && !sameKey(ident.SigningKey, feed.SigningKey) {
+		return fmt.Errorf("%w: feed %s has the ID %q of a feed signed by a different key", ErrFeedIdentity, feedURL, feed.ID)
+	}
+	return nil
+}
+
+// checkFeedIdentity returns an error wrapping ErrFeedIdentity if feed, fetched
+// from feedURL, does not match the feed IDs seen before. See identities.check.
+func (c cache) checkFeedIdentity(feedURL string, feed *Feed) error {
+	x, err := c.loadIdentities()
+	if err != nil {
+		return err
+	}
+	return x.check(feedURL, feed)
+}
+
+// identityOf returns the identity of the feed at feedURL, or nil if it has
+// none.
+func (c cache) identityOf(feedURL string) *feedIdentity {
+	x, err := c.loadIdentities()
+	if err != nil {
+		return nil
+	}
+	return x.byURL(feedURL)
+}
+
+// signedFeedID returns id if it is bound to a signing key, or the empty
+// string.
+//
+// Installs are only merged by ID if the ID has a signing key, since any feed
+// can claim an ID without one.
+func (c cache) signedFeedID(id string) string {
+	if id == "" {
+		return ""
+	}
+	x, err := c.loadIdentities()
+	if err != nil {
+		return ""
+	}
+	if ident := x.byID(id); ident != nil && ident.SigningKey != "" {
+		return id
+	}
+	return ""
+}
+
+// feedIDDirName returns the name of the cache directory of the feed with ID
+// id in older versions of zerogame.
+func feedIDDirName(id string) string {
+	return uuid.NewMD5(uuid.NameSpaceURL, []byte("urn:zerogame:feed:"+id)).String()
+}
+
+// bindFeedID records that feed, with its ID, was installed from feedURL out
+// of the cache directory dir. It is only called once the feed's archive has
+// been verified, and verified reports whether it was verified with the
+// feed's signing key.
+//
+// The first verified signing key of an ID is bound to it. Another URL is only
+// added to an ID that has a signing key, and only if the archive was
+// verified with that key; otherwise the feed is tracked by its URL alone.
+//
+// It returns an error wrapping ErrFeedIdentity if the ID was bound to a
+// different signing key, or if the feed at feedURL had a different ID.
+func (c cache) bindFeedID(feedURL string, feed *Feed, dir string, verified bool) error {
+	if feed.ID == "" {
+		return nil
+	}
+	x, err := c.loadIdentities()
+	if err != nil {
+		return err
+	}
+	if err := x.check(feedURL, feed); err != nil {
+		return err
+	}
+	ident := x.byID(feed.ID)
+	switch {
+	case ident == nil:
+		x.Feeds = append(x.Feeds, feedIdentity{ID: feed.ID, URLs: []string{feedURL}})
+		ident = &x.Feeds[len(x.Feeds)-1]
+	case ident.hasURL(feedURL):
+	case ident.SigningKey != "" && verified:
+		ident.URLs = append(ident.URLs, feedURL)
+	default:
+		return nil
+	}
+	if ident.SigningKey == "" && verified {
+		ident.SigningKey = feed.SigningKey
+	}
+	ident.Dir = filepath.Base(dir)
+	if feed.MovedTo == "" || ident.URL == "" {
+		ident.URL = feedURL
+	}
+	return x.save()
+}
+
+// verifiedWithFeedKey reports whether the cached archive of feedURL was
+// verified with the signing key bound to the ID of feed, and feedURL is one of
+// the URLs of that ID.
+func (c cache) verifiedWithFeedKey(feedURL string, feed *Feed) bool {
+	if feed.ID == "" {
+		return false
+	}
+	cached, err := c.GetFeedArchive(feedURL)
+	if err != nil || cached.VerificationMethod != GPGDetachedSignatureMethod {
+		return false
+	}
+	x, err := c.loadIdentities()
+	if err != nil {
+		return false
+	}
+	ident := x.byID(feed.ID)
+	return ident != nil && ident.hasURL(feedURL) && ident.SigningKey != "" && sameKey(ident.SigningKey, cached.Feed.SigningKey)
+}
+
+// bindFeedMove records that the feed installed from oldURL moved to feedURL,
+// where it has the ID of feed, so both URLs share the feed's cache directory
+// and feedURL is the feed's canonical URL.
+//
+// It is only called once the moved feed's archive was verified with the
+// signing key bound to its ID. See recordFeedMove.
+func (c cache) bindFeedMove(oldURL, feedURL string, feed *Feed) error {
+	x, err := c.loadIdentities()
+	if err != nil {
+		return err
+	}
+	if err := x.check(feedURL, feed); err != nil {
+		return err
+	}
+	ident := x.byURL(oldURL)
+	if ident == nil || ident.ID != feed.ID {
+		return fmt.Errorf("%w: feed %s moved to %s, which has a different ID", ErrFeedIdentity, oldURL, feedURL)
+	}
+	if !ident.hasURL(feedURL) {
+		ident.URLs = append(ident.URLs, feedURL)
+	}
+	ident.URL = feedURL
+	return x.save()
+}
+
+// fetchCanonicalFeed fetches the feed at feedURL and follows the moves it
+// announces.
+//
+// It returns the feed and the URL it was fetched from.
+func (c cache) fetchCanonicalFeed(ctx context.Context, d *downloader, feedURL string) (*Feed, string, error) {
+	feed, err := c.fetchFeed(ctx, d, feedURL)
+	if err != nil {
+		return nil, "", err
+	}
+	for moves := 0; feed.MovedTo != ""; moves++ {
+		if moves == maxFeedMoves {
+			return nil, "", fmt.Errorf("feed %s moved more than %d times", feedURL, maxFeedMoves)
+		}
+		movedTo := normalizeFeedURL(feed.MovedTo)
+		fmt.Fprintf(os.Stderr, "Feed %s has moved to %s\n", feedURL, movedTo)
+		moved, err := c.fetchFeed(ctx, d, movedTo)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to fetch moved feed: %w", err)
+		}
+		if feed.ID != "" && moved.ID != feed.ID {
+			return nil, "", fmt.Errorf("%w: feed %s moved to %s, which has ID %q instead of %q", ErrFeedIdentity, feedURL, movedTo, moved.ID, feed.ID)
+		}
+		feed, feedURL = moved, movedTo
+	}
+	return feed, feedURL, nil
+}
@@ -0,0 +1,314 @@
+package zerogame
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// newTestGameArchive returns a zip archive that installs on this platform
+// without doing anything.
+func newTestGameArchive(t *testing.T) []byte {
+	t.Helper()
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("true is not installed")
+	}
+	return newTestInstallArchive(t, Platform{
+		InstallCommand:   []string{"true"},
+		UninstallCommand: []string{"true"},
+		RunCommand:       []string{"true"},
+	})
+}
+
+// newTestInstallArchive returns a zip archive whose install.json has the
+// commands of platform for this platform.
+func newTestInstallArchive(t *testing.T, platform Platform) []byte {
+	t.Helper()
+	platform.Name = currentPlatform()
+	install, err := json.Marshal(InstallFile{Platforms: []Platform{platform}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := writeZipFile(zw, "install.json", install); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testGameServer serves feeds of a game archive.
+type testGameServer struct {
+	*httptest.Server
+	archive []byte
+	files   map[string][]byte
+}
+
+// newTestGameServer serves feeds of the archive made by newTestGameArchive.
+func newTestGameServer(t *testing.T) *testGameServer {
+	t.Helper()
+	return newTestArchiveServer(t, newTestGameArchive(t))
+}
+
+// newTestArchiveServer serves feeds of archive.
+func newTestArchiveServer(t *testing.T, archive []byte) *testGameServer {
+	t.Helper()
+	s := &testGameServer{archive: archive, files: map[string][]byte{}}
+	s.files["/game.zip"] = s.archive
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// addFeed serves a feed with the ID id at path and returns its URL. The
+// archive is signed by signer if it is not nil.
+func (s *testGameServer) addFeed(t *testing.T, path, id string, signer *crypto.Key) string {
+	t.Helper()
+	feed := newTestFeed(s.archive)
+	feed.ID = id
+	feed.ArchiveURL = s.URL + "/game.zip"
+	if signer != nil {
+		feed.SigningKey = signer.GetFingerprint()
+		feed.GPGSignatureURL = s.URL + path + ".sig"
+		s.files[path+".sig"] = signDetached(t, signer, s.archive)
+	}
+	doc, err := json.Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.files[path] = doc
+	return s.URL + path
+}
+
+func loadTestRegistry(t *testing.T) *registry {
+	t.Helper()
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := c.loadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func TestFetchFeedDoesNotBindFeedID(t *testing.T) {
+	trusted, other := newTestKey(t, "trusted"), newTestKey(t, "other")
+	useTestKeyRing(t, trusted, other)
+	s := newTestGameServer(t)
+	impostor := s.addFeed(t, "/impostor/feed.json", "com.example.game", other)
+	genuine := s.addFeed(t, "/game/feed.json", "com.example.game", trusted)
+
+	// Checking for updates fetches the feed without installing it.
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.fetchFeed(context.Background(), newDownloader(FetchOptions{}, nil), impostor); err != nil {
+		t.Fatalf("fetchFeed() = %v", err)
+	}
+	if _, err := os.Stat(c.identities.filename); !os.IsNotExist(err) {
+		t.Errorf("fetchFeed() recorded the feed's ID: %v", err)
+	}
+
+	if err := InstallFeed(context.Background(), genuine, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	err = InstallFeed(context.Background(), impostor, InstallFeedOptions{VerificationMethod: AutoSelectMethod})
+	if !errors.Is(err, ErrFeedIdentity) {
+		t.Errorf("InstallFeed() of a feed signed by another key = %v, want %v", err, ErrFeedIdentity)
+	}
+}
+
+func TestInstallFeedDoesNotBindUnverifiedSigningKey(t *testing.T) {
+	trusted, other := newTestKey(t, "trusted"), newTestKey(t, "other")
+	useTestKeyRing(t, trusted, other)
+	s := newTestGameServer(t)
+	impostor := s.addFeed(t, "/impostor/feed.json", "com.example.game", other)
+	genuine := s.addFeed(t, "/game/feed.json", "com.example.game", trusted)
+
+	opts := InstallFeedOptions{VerificationMethod: DoNotVerifyMethod}
+	if err := InstallFeed(context.Background(), impostor, opts); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	if err := InstallFeed(context.Background(), genuine, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() of the signed feed = %v", err)
+	}
+	if reg := loadTestRegistry(t); len(reg.Feeds) != 2 {
+		t.Errorf("registry has %d feeds, want the unverified feed to be installed separately", len(reg.Feeds))
+	}
+}
+
+func TestInstallFeedDoesNotMergeUnsignedIDs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := newTestGameServer(t)
+	original := s.addFeed(t, "/game/feed.json", "com.example.game", nil)
+	impostor := s.addFeed(t, "/impostor/feed.json", "com.example.game", nil)
+
+	for _, feedURL := range []string{original, impostor} {
+		if err := InstallFeed(context.Background(), feedURL, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+			t.Fatalf("InstallFeed(%s) = %v", feedURL, err)
+		}
+	}
+	reg := loadTestRegistry(t)
+	installed, err := reg.find(original)
+	if err != nil {
+		t.Fatalf("the feed at %s was replaced: %v", original, err)
+	}
+	if _, err := os.Stat(installed.InstallDir); err != nil {
+		t.Errorf("the feed at %s was uninstalled: %v", original, err)
+	}
+	if len(reg.Feeds) != 2 {
+		t.Errorf("registry has %d feeds, want 2", len(reg.Feeds))
+	}
+}
+
+func TestInstallFeedMergesSignedIDs(t *testing.T) {
+	trusted := newTestKey(t, "trusted")
+	useTestKeyRing(t, trusted)
+	s := newTestGameServer(t)
+	original := s.addFeed(t, "/game/feed.json", "com.example.game", trusted)
+	mirror := s.addFeed(t, "/mirror/feed.json", "com.example.game", trusted)
+
+	if err := InstallFeed(context.Background(), original, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	previous, err := loadTestRegistry(t).find(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallFeed(context.Background(), mirror, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	reg := loadTestRegistry(t)
+	if len(reg.Feeds) != 1 || reg.Feeds[0].FeedURL != mirror {
+		t.Fatalf("registry has %+v, want only %s", reg.Feeds, mirror)
+	}
+	// The feed was installed from the mirror's cache directory, so the
+	// original URL's directory is no longer used.
+	if dir := filepath.Dir(previous.ArchivePath); dir == filepath.Dir(reg.Feeds[0].ArchivePath) {
+		t.Errorf("both installs used %s", dir)
+	} else if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("the previous cache directory %s was not removed: %v", dir, err)
+	}
+
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.feedDir(original) != c.feedDir(mirror) {
+		t.Errorf("feedDir(%s) = %s, want the directory of %s, %s", original, c.feedDir(original), mirror, c.feedDir(mirror))
+	}
+}
+
+// moveFeed replaces the feed at path with one that announces it moved to
+// movedTo, and returns movedTo's URL. The feed names signer's key if signer is
+// not nil.
+func (s *testGameServer) moveFeed(t *testing.T, path, id, movedTo string, signer *crypto.Key) string {
+	t.Helper()
+	feed := Feed{ID: id, MovedTo: movedTo}
+	if signer != nil {
+		feed.SigningKey = signer.GetFingerprint()
+	}
+	doc, err := json.Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.files[path] = doc
+	return s.URL + movedTo
+}
+
+// setVersion changes the version of the feed at path.
+func (s *testGameServer) setVersion(t *testing.T, path, version string) {
+	t.Helper()
+	var feed Feed
+	if err := json.Unmarshal(s.files[path], &feed); err != nil {
+		t.Fatal(err)
+	}
+	feed.Version = version
+	doc, err := json.Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.files[path] = doc
+}
+
+func TestUpdateFeedsRecordsSignedMove(t *testing.T) {
+	trusted := newTestKey(t, "trusted")
+	useTestKeyRing(t, trusted)
+	s := newTestGameServer(t)
+	original := s.addFeed(t, "/game/feed.json", "com.example.game", trusted)
+	if err := InstallFeed(context.Background(), original, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	s.addFeed(t, "/new/feed.json", "com.example.game", trusted)
+	s.setVersion(t, "/new/feed.json", "2.0")
+	moved := s.moveFeed(t, "/game/feed.json", "com.example.game", "/new/feed.json", trusted)
+
+	if _, err := UpdateFeeds(context.Background(), UpdateFeedsOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("UpdateFeeds() = %v", err)
+	}
+	reg := loadTestRegistry(t)
+	if len(reg.Feeds) != 1 || reg.Feeds[0].FeedURL != moved || reg.Feeds[0].Version != "2.0" {
+		t.Fatalf("registry has %+v, want version 2.0 from %s", reg.Feeds, moved)
+	}
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.feedDir(original) != c.feedDir(moved) {
+		t.Errorf("feedDir(%s) = %s, want the directory of %s, %s", moved, c.feedDir(moved), original, c.feedDir(original))
+	}
+}
+
+func TestUpdateFeedsDoesNotRecordUnsignedMove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := newTestGameServer(t)
+	original := s.addFeed(t, "/game/feed.json", "com.example.game", nil)
+	if err := InstallFeed(context.Background(), original, InstallFeedOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("InstallFeed() = %v", err)
+	}
+	s.addFeed(t, "/new/feed.json", "com.example.game", nil)
+	s.setVersion(t, "/new/feed.json", "2.0")
+	moved := s.moveFeed(t, "/game/feed.json", "com.example.game", "/new/feed.json", nil)
+
+	if _, err := UpdateFeeds(context.Background(), UpdateFeedsOptions{VerificationMethod: AutoSelectMethod}); err != nil {
+		t.Fatalf("UpdateFeeds() = %v", err)
+	}
+	reg := loadTestRegistry(t)
+	if len(reg.Feeds) != 1 || reg.Feeds[0].FeedURL != original {
+		t.Fatalf("registry has %+v, want only %s", reg.Feeds, original)
+	}
+	c, err := newDefaultCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := c.loadIdentities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident := x.byURL(moved); ident != nil {
+		t.Errorf("identity of %s = %+v, want none", moved, ident)
+	}
+}
@@ -0,0 +1,57 @@
+package zerogame
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FeedInfo describes what is known about a feed on this machine.
+type FeedInfo struct {
+	// FeedURL is the feed's URL.
+	FeedURL string
+
+	// Installed is the installed version of the feed, or nil if the feed is
+	// not installed.
+	Installed *InstalledFeed
+
+	// Archive is the feed's newest cached archive, or nil if none is cached.
+	Archive *CachedArchive
+
+	// FetchedAt is when the feed was last fetched or found unchanged. It is
+	// zero if the feed document is not cached.
+	FetchedAt time.Time
+}
+
+// GetFeedInfo returns what is known about an installed or cached feed, given
+// its URL or the name of an installed feed.
+func GetFeedInfo(feedURLOrName string) (*FeedInfo, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FeedInfo{FeedURL: normalizeFeedURL(feedURLOrName)}
+	installed, err := cache.findInstalled(reg, feedURLOrName)
+	switch {
+	case err == nil:
+		info.Installed = installed
+		info.FeedURL = installed.FeedURL
+	case !errors.Is(err, ErrNotInstalled):
+		return nil, err
+	}
+	if archive, err := cache.GetFeedArchive(info.FeedURL); err == nil {
+		info.Archive = archive
+	}
+	if data, meta := cache.readCachedFeed(info.FeedURL); data != nil {
+		info.FetchedAt = meta.FetchedAt
+	}
+	if info.Installed == nil && info.Archive == nil && info.FetchedAt.IsZero() {
+		return nil, fmt.Errorf("%w and not cached: %s", ErrNotInstalled, feedURLOrName)
+	}
+	return info, nil
+}
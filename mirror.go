@@ -0,0 +1,154 @@
+package zerogame
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorOrder chooses the order in which the mirrors of an archive are tried.
+type MirrorOrder int
+
+const (
+	// FeedMirrorOrder tries the archive URL first, then the mirrors in the
+	// order they are listed in the feed.
+	FeedMirrorOrder MirrorOrder = iota
+
+	// LatencyMirrorOrder tries the mirrors that respond fastest first.
+	LatencyMirrorOrder
+)
+
+// ParseMirrorOrder parses "feed" or "latency" into a MirrorOrder.
+func ParseMirrorOrder(s string) (MirrorOrder, error) {
+	switch strings.ToLower(s) {
+	case "", "feed":
+		return FeedMirrorOrder, nil
+	case "latency":
+		return LatencyMirrorOrder, nil
+	}
+	return 0, fmt.Errorf("invalid mirror order %q. must be feed or latency", s)
+}
+
+func (o MirrorOrder) String() string {
+	if o == LatencyMirrorOrder {
+		return "latency"
+	}
+	return "feed"
+}
+
+const (
+	// mirrorProbeTimeout limits how long a mirror may take to respond when
+	// mirrors are ordered by latency.
+	mirrorProbeTimeout = 10 * time.Second
+
+	// mirrorProbeDrainLimit is how much of a mirror's response is read after
+	// it was measured, so the connection can be reused. Mirrors that ignore
+	// the probe's range send the whole archive, which is not read.
+	mirrorProbeDrainLimit = 64 << 10
+)
+
+// urls returns the archive URL followed by its mirrors.
+func (a *Archive) urls() []string {
+	return mirrorURLs(a.ArchiveURL, a.Mirrors)
+}
+
+// signatureURLs returns the GPG signature URL followed by its mirrors.
+func (a *Archive) signatureURLs() []string {
+	return mirrorURLs(a.GPGSignatureURL, a.GPGSignatureMirrors)
+}
+
+func mirrorURLs(u string, mirrors []string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, m := range append([]string{u}, mirrors...) {
+		if m != "" && !seen[m] {
+			seen[m] = true
+			urls = append(urls, m)
+		}
+	}
+	return urls
+}
+
+// orderMirrors returns urls in the order they should be tried.
+func (d *downloader) orderMirrors(ctx context.Context, urls []string) []string {
+	if d.opts.MirrorOrder != LatencyMirrorOrder || len(urls) < 2 {
+		return urls
+	}
+
+	// Measure how long each mirror takes to start responding by requesting
+	// the first byte of the archive. Mirrors that fail are tried last.
+	latencies := make([]time.Duration, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, mirrorProbeTimeout)
+			defer cancel()
+			start := time.Now()
+			res, err := d.fetch(ctx, &FetchRequest{URL: u, Length: 1})
+			if err != nil {
+				latencies[i] = -1
+				return
+			}
+			latencies[i] = time.Since(start)
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, mirrorProbeDrainLimit))
+			res.Body.Close()
+		}(i, u)
+	}
+	wg.Wait()
+
+	order := make([]int, len(urls))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := latencies[order[i]], latencies[order[j]]
+		if a < 0 || b < 0 {
+			return b < 0 && a >= 0
+		}
+		return a < b
+	})
+	sorted := make([]string, len(urls))
+	for i, j := range order {
+		sorted[i] = urls[j]
+		if latencies[j] < 0 {
+			fmt.Fprintf(os.Stderr, "Mirror %s: unreachable\n", urls[j])
+		} else {
+			fmt.Fprintf(os.Stderr, "Mirror %s: %v\n", urls[j], latencies[j].Round(time.Millisecond))
+		}
+	}
+	return sorted
+}
+
+// getMirrorURL reads the entire contents of the first of urls that can be
+// fetched.
+func (d *downloader) getMirrorURL(ctx context.Context, urls []string) ([]byte, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no URL was given")
+	}
+	var err error
+	for i, u := range urls {
+		var data []byte
+		if data, err = d.getURL(ctx, u); err == nil {
+			if i > 0 {
+				fmt.Fprintf(os.Stderr, "Fetched %s from mirror\n", u)
+			}
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if i+1 < len(urls) {
+			fmt.Fprintf(os.Stderr, "Mirror %s failed: %v\n", u, err)
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,43 @@
+package zerogame
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrderMirrorsProbesFirstByte(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	archive := bytes.Repeat([]byte("archive contents"), 1<<12)
+	var mu sync.Mutex
+	var ranges []string
+	newMirror := func(delay time.Duration) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+			time.Sleep(delay)
+			http.ServeContent(w, r, "game.zip", time.Time{}, bytes.NewReader(archive))
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	slow, fast := newMirror(200*time.Millisecond), newMirror(0)
+	urls := []string{slow.URL + "/game.zip", fast.URL + "/game.zip"}
+
+	d := newDownloader(FetchOptions{MirrorOrder: LatencyMirrorOrder}, nil)
+	got := d.orderMirrors(context.Background(), urls)
+	if want := []string{urls[1], urls[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("orderMirrors() = %v, want %v", got, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"bytes=0-0", "bytes=0-0"}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("mirrors received ranges %q, want %q", ranges, want)
+	}
+}
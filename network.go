@@ -0,0 +1,178 @@
+package zerogame
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// NetworkConfig configures the proxy and TLS settings used to fetch feeds,
+// archives and signatures over HTTP.
+//
+// Each setting can be overridden by an environment variable:
+//
+//	ZEROGAME_PROXY        Proxy
+//	ZEROGAME_NO_PROXY     NoProxy
+//	ZEROGAME_CA_BUNDLE    CABundle
+//	ZEROGAME_CLIENT_CERT  ClientCert
+//	ZEROGAME_CLIENT_KEY   ClientKey
+type NetworkConfig struct {
+	// Proxy is the URL of the proxy for all requests, such as
+	// http://proxy.example.com:3128.
+	//
+	// Defaults to the proxy set by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables.
+	Proxy string `json:"proxy,omitempty"`
+
+	// NoProxy is a comma-separated list of hosts that are not fetched
+	// through Proxy. An entry matches the host itself and its subdomains, and
+	// "*" matches every host.
+	NoProxy string `json:"no_proxy,omitempty"`
+
+	// CABundle is the path of a PEM file of certificate authorities trusted in
+	// addition to the system's.
+	CABundle string `json:"ca_bundle,omitempty"`
+
+	// ClientCert and ClientKey are the paths of the PEM encoded certificate and
+	// private key presented to servers that request a client certificate.
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+}
+
+func (c *NetworkConfig) applyEnvironment() {
+	for name, field := range map[string]*string{
+		"ZEROGAME_PROXY":       &c.Proxy,
+		"ZEROGAME_NO_PROXY":    &c.NoProxy,
+		"ZEROGAME_CA_BUNDLE":   &c.CABundle,
+		"ZEROGAME_CLIENT_CERT": &c.ClientCert,
+		"ZEROGAME_CLIENT_KEY":  &c.ClientKey,
+	} {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+}
+
+// ProxyFunc returns the function that chooses the proxy for a request, as
+// used by http.Transport.
+func (c *NetworkConfig) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if c.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(c.Proxy)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", c.Proxy)
+	}
+	return func(r *http.Request) (*url.URL, error) {
+		if c.bypassProxy(r.URL) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+func (c *NetworkConfig) bypassProxy(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, entry := range strings.Split(c.NoProxy, ",") {
+		entry = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(entry), "."))
+		switch {
+		case entry == "":
+		case entry == "*":
+			return true
+		case strings.EqualFold(entry, u.Host), host == entry, strings.HasSuffix(host, "."+entry):
+			return true
+		}
+	}
+	return false
+}
+
+// TLSConfig returns the TLS configuration for the CA bundle and client
+// certificate, or nil if neither is set.
+func (c *NetworkConfig) TLSConfig() (*tls.Config, error) {
+	if c.CABundle == "" && c.ClientCert == "" && c.ClientKey == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if c.CABundle != "" {
+		pem, err := ioutil.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s has no PEM encoded certificates", c.CABundle)
+		}
+		config.RootCAs = pool
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if c.ClientCert == "" || c.ClientKey == "" {
+			return nil, errors.New("both a client certificate and a client key are needed")
+		}
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// NewHTTPClient returns an HTTP client that uses the proxy and TLS settings
+// of config.
+func NewHTTPClient(config NetworkConfig) (*http.Client, error) {
+	proxy, err := config.ProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			r.URL.Opaque = r.URL.Path
+			return nil
+		},
+	}, nil
+}
+
+var defaultHTTPClient struct {
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+// DefaultHTTPClient returns the HTTP client configured by the network
+// settings of the zerogame configuration file.
+//
+// The client is created once, the first time DefaultHTTPClient is called.
+func DefaultHTTPClient() (*http.Client, error) {
+	defaultHTTPClient.once.Do(func() {
+		config, err := loadDefaultConfig()
+		if err != nil {
+			defaultHTTPClient.err = err
+			return
+		}
+		defaultHTTPClient.client, defaultHTTPClient.err = NewHTTPClient(config.Network)
+		if defaultHTTPClient.err != nil {
+			defaultHTTPClient.err = fmt.Errorf("invalid network configuration: %w", defaultHTTPClient.err)
+		}
+	})
+	return defaultHTTPClient.client, defaultHTTPClient.err
+}
@@ -0,0 +1,135 @@
+package zerogame
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotCached is returned when an offline install needs a feed, archive or
+// signature that is not in the cache.
+var ErrNotCached = errors.New("not available offline")
+
+// loadOfflineFeed selects the release to install from the cached copy of
+// feedURL and verifies its cached archive again.
+//
+// On success, the release's archive is the cached archive of feedURL.
+func (c cache) loadOfflineFeed(feedURL string, opts InstallFeedOptions) (*Feed, error) {
+	data, meta := c.readCachedFeed(feedURL)
+	if data == nil {
+		return nil, fmt.Errorf("%w: feed %s has never been fetched", ErrNotCached, feedURL)
+	}
+	feed, err := parseFeed(meta.URL, data)
+	if err != nil {
+		return nil, fmt.Errorf("cached feed %s is invalid: %w", feedURL, err)
+	}
+	feed, err = selectRelease(feed, opts.Version, opts.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	archivePath := filepath.Join(c.feedDir(feedURL), feedArchiveName(feed))
+	cached, err := c.readCachedArchive(feedURL, archivePath)
+	if err != nil && opts.Version == "" && opts.Channel == "" {
+		// The feed has a newer release than the one that was downloaded.
+		// Fall back to the last downloaded release.
+		if previous, prevErr := c.GetFeedArchive(feedURL); prevErr == nil && previous.Feed.Version != "" {
+			fmt.Fprintf(os.Stderr, "Version %s of %s is not cached. Using the cached version %s\n", feed.Version, feed.Name, previous.Feed.Version)
+			feed, cached, err = &previous.Feed, previous, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: archive %s of %s has not been downloaded", ErrNotCached, feedArchiveName(feed), feedURL)
+	}
+
+	if err := verifyCachedArchive(feed, cached, opts.VerificationMethod); err != nil {
+		return nil, fmt.Errorf("failed to verify cached archive %s: %w", cached.Path, err)
+	}
+	if err := c.writeMarker(feedURL, filepath.Base(cached.Path)); err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// verifyCachedArchive verifies a cached archive against feed using method,
+// without using the network.
+func verifyCachedArchive(feed *Feed, cached *CachedArchive, method VerificationMethod) error {
+	if method == AutoSelectMethod {
+		method = selectVerificationMethod(feed)
+	}
+	var signature []byte
+	if method == GPGDetachedSignatureMethod {
+		if cached.SignaturePath == "" {
+			return fmt.Errorf("%w: the signature of %s has not been downloaded", ErrNotCached, filepath.Base(cached.Path))
+		}
+		var err error
+		if signature, err = ioutil.ReadFile(cached.SignaturePath); err != nil {
+			return err
+		}
+	}
+	_, err := verifyArchiveFile(feed, cached.File, signature, method)
+	return err
+}
+
+// verifyArchiveFile verifies the archive at filename against feed using
+// method. signature is the archive's detached GPG signature, if it has one.
+//
+// The archive must not be used if an error is returned.
+func verifyArchiveFile(feed *Feed, filename string, signature []byte, method VerificationMethod) (*archiveDownload, error) {
+	switch method {
+	case AutoSelectMethod:
+		return verifyArchiveFile(feed, filename, signature, selectVerificationMethod(feed))
+	case DoNotVerifyMethod:
+		size, sum, err := hashFile(filename, ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyChecksum(&feed.Archive, size, sum); err != nil {
+			return nil, err
+		}
+		return &archiveDownload{method: method, size: size, sha256: sum}, nil
+	case ChecksumMethod:
+		if feed.ArchiveSHA256 == "" {
+			return nil, errors.New("feed has no archive_sha256")
+		}
+		size, sum, err := hashFile(filename, ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyChecksum(&feed.Archive, size, sum); err != nil {
+			return nil, err
+		}
+		return &archiveDownload{method: method, size: size, sha256: sum}, nil
+	case GPGDetachedSignatureMethod:
+		if signature == nil {
+			return nil, errors.New("archive has no signature")
+		}
+		keyRing, err := readFeedKeyRing(feed)
+		if err != nil {
+			return nil, err
+		}
+		pr, pw := io.Pipe()
+		verified := make(chan error, 1)
+		go func() {
+			err := verifyDetachedSignature(keyRing, pr, signature)
+			pr.CloseWithError(errVerificationStopped)
+			verified <- err
+		}()
+		size, sum, err := hashFile(filename, pw)
+		pw.CloseWithError(err)
+		if verifyErr := <-verified; verifyErr != nil {
+			return nil, verifyErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyChecksum(&feed.Archive, size, sum); err != nil {
+			return nil, err
+		}
+		return &archiveDownload{method: method, size: size, sha256: sum, signature: signature}, nil
+	}
+	return nil, fmt.Errorf("unsupported verification method: %v", method)
+}
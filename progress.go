@@ -0,0 +1,83 @@
+package zerogame
+
+import "time"
+
+// progressInterval is the minimum time between two calls to a ProgressFunc.
+const progressInterval = 100 * time.Millisecond
+
+// Progress describes the progress of a download.
+type Progress struct {
+	// URL is the URL being downloaded.
+	URL string
+
+	// BytesDone is the number of bytes downloaded so far.
+	BytesDone int64
+
+	// BytesTotal is the size of the download, or -1 if it is unknown.
+	BytesTotal int64
+
+	// Rate is the average download rate in bytes per second.
+	//
+	// Bytes downloaded before a download was resumed are not included.
+	Rate float64
+
+	// ETA is the estimated time until the download completes, or zero if it
+	// is unknown.
+	ETA time.Duration
+
+	// Done is true when the download has finished.
+	Done bool
+}
+
+// ProgressFunc is called periodically while a download is in progress.
+type ProgressFunc func(Progress)
+
+// progressWriter reports the number of bytes written to it to a ProgressFunc.
+type progressWriter struct {
+	url      string
+	total    int64
+	done     int64
+	resumed  int64
+	fn       ProgressFunc
+	start    time.Time
+	reported time.Time
+}
+
+// newProgressWriter returns a progressWriter for a download of total bytes
+// that resumed after the first done bytes.
+func newProgressWriter(url string, done, total int64, fn ProgressFunc) *progressWriter {
+	return &progressWriter{url: url, total: total, done: done, resumed: done, fn: fn, start: time.Now()}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.done += int64(len(p))
+	if now := time.Now(); now.Sub(w.reported) >= progressInterval {
+		w.reported = now
+		w.report(false)
+	}
+	return len(p), nil
+}
+
+// finish reports the final progress of the download.
+func (w *progressWriter) finish() {
+	w.report(true)
+}
+
+func (w *progressWriter) report(done bool) {
+	if w.fn == nil {
+		return
+	}
+	p := Progress{
+		URL:        w.url,
+		BytesDone:  w.done,
+		BytesTotal: w.total,
+		Done:       done,
+	}
+	if elapsed := time.Since(w.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(w.done-w.resumed) / elapsed
+	}
+	if p.Rate > 0 && w.total > w.done {
+		p.ETA = time.Duration(float64(w.total-w.done) / p.Rate * float64(time.Second))
+	}
+	w.fn(p)
+}
@@ -0,0 +1,185 @@
+package zerogame
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const registryName = "installed.json"
+
+// ErrNotInstalled is returned when a feed is not installed on this machine.
+var ErrNotInstalled = errors.New("feed is not installed")
+
+// InstalledFeed describes a feed that is installed on this machine.
+type InstalledFeed struct {
+	// FeedURL is the URL the feed was installed from, or the URL it moved to.
+	FeedURL string `json:"feed_url"`
+
+	// FeedID is the ID of the installed feed, if it has one.
+	FeedID string `json:"feed_id,omitempty"`
+
+	// Name is the display name of the installed feed.
+	Name string `json:"name"`
+
+	// Version is the installed feed's version string.
+	Version string `json:"version"`
+
+	// ArchivePath is the cached archive that was installed.
+	ArchivePath string `json:"archive_path"`
+
+	// ArchiveSHA256 is the hex-encoded SHA-256 hash of the installed archive.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+
+	// InstallDir is the directory the archive was extracted to.
+	InstallDir string `json:"install_dir"`
+
+	// InstalledAt is when the feed was installed.
+	InstalledAt time.Time `json:"installed_at"`
+
+	// Channel is the release channel the feed is updated from.
+	Channel Channel `json:"channel,omitempty"`
+
+	// Pinned is true if a specific version was installed.
+	//
+	// Pinned feeds are not updated.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// ListInstalledFeeds returns the feeds installed on this machine.
+func ListInstalledFeeds() ([]InstalledFeed, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return reg.Feeds, nil
+}
+
+// registry records the feeds that are installed on this machine.
+type registry struct {
+	filename string
+
+	Feeds []InstalledFeed `json:"feeds"`
+}
+
+func (c cache) loadRegistry() (*registry, error) {
+	r := &registry{filename: filepath.Join(c.dir, registryName)}
+	data, err := ioutil.ReadFile(r.filename)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", r.filename, err)
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", r.filename, err)
+	}
+	return r, nil
+}
+
+func (r *registry) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	ensureDir(filepath.Dir(r.filename))
+	return writeFileAtomic(r.filename, data, 0644)
+}
+
+// find returns the installed feed whose URL or name is feedURLOrName.
+func (r *registry) find(feedURLOrName string) (*InstalledFeed, error) {
+	feedURL := normalizeFeedURL(feedURLOrName)
+	for i := range r.Feeds {
+		if r.Feeds[i].FeedURL == feedURL {
+			return &r.Feeds[i], nil
+		}
+	}
+	var found *InstalledFeed
+	for i := range r.Feeds {
+		if r.Feeds[i].Name != feedURLOrName {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%q matches more than one installed feed. use the feed URL instead", feedURLOrName)
+		}
+		found = &r.Feeds[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%q: %w", feedURLOrName, ErrNotInstalled)
+	}
+	return found, nil
+}
+
+// findFeed returns the installed feed with the ID id, or the installed feed
+// at feedURL if id is empty or not installed.
+//
+// Callers only pass an ID bound to a signing key. See cache.signedFeedID.
+func (r *registry) findFeed(feedURL, id string) (*InstalledFeed, error) {
+	if id != "" {
+		for i := range r.Feeds {
+			if r.Feeds[i].FeedID == id {
+				return &r.Feeds[i], nil
+			}
+		}
+	}
+	for i := range r.Feeds {
+		if r.Feeds[i].FeedURL == feedURL {
+			return &r.Feeds[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%q: %w", feedURL, ErrNotInstalled)
+}
+
+// put records feed, replacing the installed feed with the same URL.
+func (r *registry) put(feed InstalledFeed) {
+	for i := range r.Feeds {
+		if r.Feeds[i].FeedURL == feed.FeedURL {
+			r.Feeds[i] = feed
+			return
+		}
+	}
+	r.Feeds = append(r.Feeds, feed)
+}
+
+func (r *registry) remove(feedURL string) {
+	for i := range r.Feeds {
+		if r.Feeds[i].FeedURL == feedURL {
+			r.Feeds = append(r.Feeds[:i], r.Feeds[i+1:]...)
+			return
+		}
+	}
+}
+
+// findInstalled looks up feedURLOrName in r.
+//
+// Feeds installed before the registry existed are recovered from the cache.
+func (c cache) findInstalled(r *registry, feedURLOrName string) (*InstalledFeed, error) {
+	installed, err := r.find(feedURLOrName)
+	if err == nil || !errors.Is(err, ErrNotInstalled) {
+		return installed, err
+	}
+	feedURL := normalizeFeedURL(feedURLOrName)
+	cached, cacheErr := c.GetFeedArchive(feedURL)
+	if cacheErr != nil {
+		return nil, err
+	}
+	archivePath := cached.Path
+	installDir := removeFileExtension(archivePath)
+	if _, statErr := os.Stat(installDir); statErr != nil {
+		return nil, err
+	}
+	return &InstalledFeed{
+		FeedURL:     feedURL,
+		Name:        filepath.Base(installDir),
+		ArchivePath: archivePath,
+		InstallDir:  installDir,
+	}, nil
+}
@@ -0,0 +1,241 @@
+package zerogame
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// URLRewriter turns share links, which open a preview page in a browser, into
+// URLs that download the file directly.
+//
+// URLRewriters are registered using RegisterURLRewriter and are applied to
+// every feed, archive and signature URL before it is fetched.
+type URLRewriter interface {
+	// RewriteURL returns the direct download URL for u, or false if u is not
+	// a share link known to the rewriter.
+	RewriteURL(u *url.URL) (*url.URL, bool)
+}
+
+// DownloadConfirmer is implemented by URLRewriters for hosts that show an
+// HTML confirmation page before some downloads, such as the virus scan
+// warning Google Drive shows for large files.
+type DownloadConfirmer interface {
+	// ConfirmDownload returns the URL that downloads the file after u
+	// returned the HTML page, or false if page is not a confirmation page.
+	ConfirmDownload(u *url.URL, page []byte) (*url.URL, bool)
+}
+
+var rewriters = struct {
+	sync.RWMutex
+	byName map[string]URLRewriter
+}{byName: make(map[string]URLRewriter)}
+
+func init() {
+	RegisterURLRewriter("dropbox", &DropboxRewriter{})
+	RegisterURLRewriter("google-drive", &GoogleDriveRewriter{})
+}
+
+// RegisterURLRewriter registers r under the given name, replacing any
+// URLRewriter registered with that name before.
+//
+// A nil r removes the URLRewriter registered with that name.
+func RegisterURLRewriter(name string, r URLRewriter) {
+	rewriters.Lock()
+	defer rewriters.Unlock()
+	if r == nil {
+		delete(rewriters.byName, name)
+		return
+	}
+	rewriters.byName[name] = r
+}
+
+// registeredRewriters returns the registered URLRewriters sorted by name.
+func registeredRewriters() []URLRewriter {
+	rewriters.RLock()
+	defer rewriters.RUnlock()
+	var names []string
+	for name := range rewriters.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var rs []URLRewriter
+	for _, name := range names {
+		rs = append(rs, rewriters.byName[name])
+	}
+	return rs
+}
+
+// RewriteURL returns the URL that downloads the file shared at u directly.
+//
+// u is returned unchanged if it is not a known share link.
+func RewriteURL(u string) string {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	for _, r := range registeredRewriters() {
+		if rewritten, ok := r.RewriteURL(parsedURL); ok {
+			return rewritten.String()
+		}
+	}
+	return u
+}
+
+// confirmDownload returns the URL that downloads the file after u returned
+// the HTML page, or false if no registered URLRewriter recognizes the page.
+func confirmDownload(u string, page []byte) (string, bool) {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+	for _, r := range registeredRewriters() {
+		if c, ok := r.(DownloadConfirmer); ok {
+			if confirmed, ok := c.ConfirmDownload(parsedURL, page); ok {
+				return confirmed.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchesHost reports whether u's host is one of hosts.
+func matchesHost(u *url.URL, hosts []string) bool {
+	for _, host := range hosts {
+		if strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// DropboxRewriter rewrites Dropbox share links to download the file by
+// setting their dl query parameter to 1.
+type DropboxRewriter struct {
+	// Hosts are the hosts that serve Dropbox share links.
+	//
+	// Defaults to www.dropbox.com and dropbox.com.
+	Hosts []string
+}
+
+// RewriteURL implements URLRewriter.
+func (r *DropboxRewriter) RewriteURL(u *url.URL) (*url.URL, bool) {
+	hosts := r.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{"www.dropbox.com", "dropbox.com"}
+	}
+	if !matchesHost(u, hosts) {
+		return nil, false
+	}
+	query := u.Query()
+	if query.Get("dl") == "1" || query.Get("raw") == "1" {
+		return nil, false
+	}
+	query.Set("dl", "1")
+	rewritten := *u
+	rewritten.RawQuery = query.Encode()
+	return &rewritten, true
+}
+
+// GoogleDriveRewriter rewrites Google Drive share links such as
+// https://drive.google.com/file/d/ID/view to download URLs, and confirms the
+// download of files too large for Google Drive to scan for viruses.
+type GoogleDriveRewriter struct {
+	// Hosts are the hosts that serve Google Drive share links.
+	//
+	// Defaults to drive.google.com.
+	Hosts []string
+
+	// DownloadURL is the URL files are downloaded from, which is given the
+	// export=download and id query parameters.
+	//
+	// Defaults to https://drive.google.com/uc.
+	DownloadURL string
+}
+
+var driveFilePath = regexp.MustCompile(`^/file/d/([^/]+)`)
+
+func (r *GoogleDriveRewriter) hosts() []string {
+	if len(r.Hosts) == 0 {
+		return []string{"drive.google.com"}
+	}
+	return r.Hosts
+}
+
+func (r *GoogleDriveRewriter) downloadURL() string {
+	if r.DownloadURL == "" {
+		return "https://drive.google.com/uc"
+	}
+	return r.DownloadURL
+}
+
+// RewriteURL implements URLRewriter.
+func (r *GoogleDriveRewriter) RewriteURL(u *url.URL) (*url.URL, bool) {
+	if !matchesHost(u, r.hosts()) {
+		return nil, false
+	}
+	var id string
+	if m := driveFilePath.FindStringSubmatch(u.Path); m != nil {
+		id = m[1]
+	} else if u.Path == "/open" || u.Path == "/uc" {
+		id = u.Query().Get("id")
+	}
+	if id == "" {
+		return nil, false
+	}
+	rewritten, err := url.Parse(r.downloadURL())
+	if err != nil {
+		return nil, false
+	}
+	query := rewritten.Query()
+	query.Set("export", "download")
+	query.Set("id", id)
+	rewritten.RawQuery = query.Encode()
+	if rewritten.String() == u.String() {
+		return nil, false
+	}
+	return rewritten, true
+}
+
+var (
+	driveDownloadForm = regexp.MustCompile(`(?s)<form[^>]*id="download-form"[^>]*action="([^"]+)"[^>]*>(.*?)</form>`)
+	driveHiddenInput  = regexp.MustCompile(`<input[^>]*type="hidden"[^>]*name="([^"]+)"[^>]*value="([^"]*)"`)
+	driveConfirmLink  = regexp.MustCompile(`href="([^"]*[?&](?:amp;)?confirm=[^"]+)"`)
+)
+
+// ConfirmDownload implements DownloadConfirmer.
+//
+// Google Drive confirms downloads either with a form whose hidden inputs are
+// sent as query parameters, or with a link carrying a confirm parameter.
+func (r *GoogleDriveRewriter) ConfirmDownload(u *url.URL, page []byte) (*url.URL, bool) {
+	hosts := append([]string{}, r.hosts()...)
+	if d, err := url.Parse(r.downloadURL()); err == nil {
+		hosts = append(hosts, d.Host)
+	}
+	if !matchesHost(u, hosts) {
+		return nil, false
+	}
+	if m := driveDownloadForm.FindSubmatch(page); m != nil {
+		action, err := u.Parse(html.UnescapeString(string(m[1])))
+		if err != nil {
+			return nil, false
+		}
+		query := action.Query()
+		for _, input := range driveHiddenInput.FindAllSubmatch(m[2], -1) {
+			query.Set(html.UnescapeString(string(input[1])), html.UnescapeString(string(input[2])))
+		}
+		action.RawQuery = query.Encode()
+		return action, true
+	}
+	if m := driveConfirmLink.FindSubmatch(page); m != nil {
+		link, err := u.Parse(html.UnescapeString(string(m[1])))
+		if err != nil {
+			return nil, false
+		}
+		return link, true
+	}
+	return nil, false
+}
@@ -0,0 +1,181 @@
+package zerogame
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// useTestRewriter registers r under name, and an HTTP fetcher that does not
+// read the user's configuration, for the rest of the test.
+func useTestRewriter(t *testing.T, name string, r URLRewriter, defaultRewriter URLRewriter) {
+	t.Helper()
+	RegisterURLRewriter(name, r)
+	RegisterFetcher("http", newTestHTTPFetcher(t, CredentialChain{}))
+	t.Cleanup(func() {
+		RegisterURLRewriter(name, defaultRewriter)
+		RegisterFetcher("http", &HTTPFetcher{})
+	})
+}
+
+func TestDropboxRewriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dl") != "1" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<!DOCTYPE html><html><body>Preview</body></html>")
+			return
+		}
+		fmt.Fprint(w, "archive")
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+	useTestRewriter(t, "dropbox", &DropboxRewriter{Hosts: []string{host}}, &DropboxRewriter{})
+
+	d := newDownloader(FetchOptions{}, nil)
+	data, err := d.getURL(context.Background(), server.URL+"/s/awg98awe9g7/mygame.zip?dl=0")
+	if err != nil {
+		t.Fatalf("getURL() = %v", err)
+	}
+	if string(data) != "archive" {
+		t.Errorf("getURL() = %q, want %q", data, "archive")
+	}
+}
+
+func TestDropboxRewriterURLs(t *testing.T) {
+	r := &DropboxRewriter{}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.dropbox.com/s/abc/game.zip?dl=0", "https://www.dropbox.com/s/abc/game.zip?dl=1"},
+		{"https://dropbox.com/s/abc/game.zip", "https://dropbox.com/s/abc/game.zip?dl=1"},
+		{"https://www.dropbox.com/s/abc/game.zip?dl=1", ""},
+		{"https://www.dropbox.com/s/abc/game.zip?raw=1", ""},
+		{"https://example.com/s/abc/game.zip?dl=0", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		got, ok := r.RewriteURL(u)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("RewriteURL(%s) = %s, want no rewrite", tt.url, got)
+		case tt.want != "" && (!ok || got.String() != tt.want):
+			t.Errorf("RewriteURL(%s) = %v, %v, want %s", tt.url, got, ok, tt.want)
+		}
+	}
+}
+
+func TestGoogleDriveRewriterURLs(t *testing.T) {
+	r := &GoogleDriveRewriter{}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://drive.google.com/file/d/FILEID/view?usp=sharing", "https://drive.google.com/uc?export=download&id=FILEID"},
+		{"https://drive.google.com/open?id=FILEID", "https://drive.google.com/uc?export=download&id=FILEID"},
+		{"https://drive.google.com/uc?id=FILEID", "https://drive.google.com/uc?export=download&id=FILEID"},
+		{"https://drive.google.com/uc?export=download&id=FILEID", ""},
+		{"https://drive.google.com/drive/folders/FOLDERID", ""},
+		{"https://example.com/file/d/FILEID/view", ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		got, ok := r.RewriteURL(u)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("RewriteURL(%s) = %s, want no rewrite", tt.url, got)
+		case tt.want != "" && (!ok || got.String() != tt.want):
+			t.Errorf("RewriteURL(%s) = %v, %v, want %s", tt.url, got, ok, tt.want)
+		}
+	}
+}
+
+func TestGoogleDriveRewriter(t *testing.T) {
+	tests := []struct {
+		name string
+		// confirmPage is the page served before the download is confirmed,
+		// or the empty string if the file is served directly.
+		confirmPage string
+	}{
+		{
+			name: "small file",
+		},
+		{
+			name: "confirm form",
+			confirmPage: `<!DOCTYPE html><html><body>
+<p>Google Drive can't scan this file for viruses.</p>
+<form id="download-form" action="/download" method="get">
+<input type="submit" value="Download anyway"/>
+<input type="hidden" name="id" value="FILEID">
+<input type="hidden" name="export" value="download">
+<input type="hidden" name="confirm" value="t">
+<input type="hidden" name="uuid" value="a&amp;b">
+</form></body></html>`,
+		},
+		{
+			name: "confirm link",
+			confirmPage: `<!DOCTYPE html><html><body>
+<p>Google Drive can't scan this file for viruses.</p>
+<a id="uc-download-link" href="/uc?export=download&amp;confirm=AbCd&amp;id=FILEID">Download anyway</a>
+</body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var confirmed url.Values
+			mux := http.NewServeMux()
+			serve := func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("id") != "FILEID" || query.Get("export") != "download" {
+					http.NotFound(w, r)
+					return
+				}
+				if tt.confirmPage != "" && query.Get("confirm") == "" {
+					w.Header().Set("Content-Type", "text/html")
+					fmt.Fprint(w, tt.confirmPage)
+					return
+				}
+				confirmed = query
+				fmt.Fprint(w, "archive")
+			}
+			mux.HandleFunc("/uc", serve)
+			mux.HandleFunc("/download", serve)
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			rewriter := &GoogleDriveRewriter{
+				Hosts:       []string{"drive.example.com"},
+				DownloadURL: server.URL + "/uc",
+			}
+			useTestRewriter(t, "google-drive", rewriter, &GoogleDriveRewriter{})
+
+			// The share link's host is not the fake server, so the request
+			// only succeeds if the link is rewritten.
+			d := newDownloader(FetchOptions{}, nil)
+			data, err := d.getURL(context.Background(), "http://drive.example.com/file/d/FILEID/view?usp=sharing")
+			if err != nil {
+				t.Fatalf("getURL() = %v", err)
+			}
+			if string(data) != "archive" {
+				t.Errorf("getURL() = %q, want %q", data, "archive")
+			}
+			if tt.confirmPage != "" && confirmed.Get("confirm") == "" {
+				t.Errorf("download was not confirmed: %v", confirmed)
+			}
+		})
+	}
+}
+
+func TestGoogleDriveRewriterDoesNotModifyHosts(t *testing.T) {
+	hosts := make([]string, 1, 2)
+	hosts[0] = "drive.example.com"
+	r := &GoogleDriveRewriter{Hosts: hosts, DownloadURL: "https://files.example.com/uc"}
+	u, _ := url.Parse("https://drive.example.com/uc?id=FILEID")
+	r.ConfirmDownload(u, []byte("<html></html>"))
+	if extra := hosts[:2][1]; extra != "" {
+		t.Errorf("ConfirmDownload() wrote %q into the caller's Hosts", extra)
+	}
+}
@@ -0,0 +1,176 @@
+package zerogame
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FeedUpdate describes a newer version of an installed feed.
+type FeedUpdate struct {
+	// FeedURL is the URL the feed was installed from.
+	FeedURL string
+
+	// Name is the display name of the feed.
+	Name string
+
+	// InstalledVersion is the version that is currently installed.
+	InstalledVersion string
+
+	// AvailableVersion is the version the feed currently points to.
+	AvailableVersion string
+}
+
+// UpdateFeedsOptions configures a call to UpdateFeeds.
+type UpdateFeedsOptions struct {
+	// CheckOnly controls whether updates are only reported and not installed.
+	CheckOnly bool
+
+	// VerificationMethod controls how an archive is verified.
+	VerificationMethod VerificationMethod
+
+	// AllowDowngrade controls whether an installed feed may be replaced by an
+	// older version.
+	AllowDowngrade bool
+
+	// Progress is called periodically while archives are downloaded.
+	Progress ProgressFunc
+
+	// FetchOptions configures how feeds and archives are fetched.
+	FetchOptions FetchOptions
+}
+
+// UpdateFeeds refetches every installed feed and upgrades the feeds whose
+// version has changed.
+//
+// Each feed is updated to the newest release in the channel it was installed
+// from. Feeds that were installed at a specific version are skipped.
+// Feeds that point to an older version than the installed one are skipped
+// unless opts.AllowDowngrade is set.
+//
+// Before a new version is installed, the old version's upgrade command is run.
+// If it has none, its uninstall command is run instead.
+//
+// UpdateFeeds returns the updates that were found, including the updates that
+// failed to install.
+func UpdateFeeds(ctx context.Context, opts UpdateFeedsOptions) ([]FeedUpdate, error) {
+	cache, err := newDefaultCache()
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := cache.loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	d := newDownloader(opts.FetchOptions, opts.Progress)
+	var updates []FeedUpdate
+	var didFail bool
+	installed := append([]InstalledFeed{}, reg.Feeds...)
+	for i := range installed {
+		if installed[i].Pinned {
+			fmt.Fprintf(os.Stderr, "Skipping %s: pinned to version %s\n", installed[i].FeedURL, installed[i].Version)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Checking feed: %s\n", installed[i].FeedURL)
+		if err := ctx.Err(); err != nil {
+			return updates, err
+		}
+		feed, feedURL, err := cache.fetchCanonicalFeed(ctx, d, installed[i].FeedURL)
+		if err == nil {
+			feed, err = selectRelease(feed, "", installed[i].Channel)
+		}
+		if err != nil {
+			didFail = true
+			fmt.Fprintf(os.Stderr, "Failed to check %s: %v\n", installed[i].FeedURL, err)
+			continue
+		}
+		if feed.Version == installed[i].Version && !archiveChanged(&installed[i], feed) {
+			continue
+		}
+		if err := cache.checkDowngrade(reg, installed[i].FeedURL, feed, opts.AllowDowngrade); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", installed[i].FeedURL, err)
+			continue
+		}
+		updates = append(updates, FeedUpdate{
+			FeedURL:          installed[i].FeedURL,
+			Name:             feed.Name,
+			InstalledVersion: installed[i].Version,
+			AvailableVersion: feed.Version,
+		})
+		if opts.CheckOnly {
+			continue
+		}
+		if err := cache.upgradeFeed(ctx, d, reg, &installed[i], feed, opts); err != nil {
+			didFail = true
+			fmt.Fprintf(os.Stderr, "Failed to update %s: %v\n", installed[i].FeedURL, err)
+			continue
+		}
+		if err := cache.recordFeedMove(reg, &installed[i], feedURL, feed); err != nil {
+			didFail = true
+			fmt.Fprintf(os.Stderr, "Failed to record the new URL of %s: %v\n", installed[i].FeedURL, err)
+		}
+	}
+
+	if didFail {
+		return updates, errors.New("some feeds failed to update")
+	}
+	return updates, nil
+}
+
+// recordFeedMove records in reg that installed, which was just upgraded to
+// feed, is now fetched from feedURL, so it is updated from feedURL from now on.
+// feedURL then shares the cache directory of the URL the feed was installed
+// from.
+//
+// Anyone who can publish the old feed can announce a move, so the move is
+// only recorded if the new archive was verified with the signing key bound to
+// the feed's ID. Otherwise the feed keeps being updated from its old URL,
+// which is checked for moves again every time.
+func (c cache) recordFeedMove(reg *registry, installed *InstalledFeed, feedURL string, feed *Feed) error {
+	if installed.FeedURL == feedURL {
+		return nil
+	}
+	if !c.verifiedWithFeedKey(installed.FeedURL, feed) {
+		fmt.Fprintf(os.Stderr, "Not updating %s from %s: the move was not verified with the feed's signing key\n", installed.Name, feedURL)
+		return nil
+	}
+	entry, err := reg.find(installed.FeedURL)
+	if err != nil {
+		return err
+	}
+	if err := c.bindFeedMove(entry.FeedURL, feedURL, feed); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Updating %s from %s from now on\n", entry.Name, feedURL)
+	entry.FeedURL = feedURL
+	*installed = *entry
+	return reg.save()
+}
+
+// archiveChanged reports whether feed was republished with a different
+// archive than the installed one.
+func archiveChanged(installed *InstalledFeed, feed *Feed) bool {
+	return feed.ArchiveSHA256 != "" && installed.ArchiveSHA256 != "" &&
+		!strings.EqualFold(feed.ArchiveSHA256, installed.ArchiveSHA256)
+}
+
+// upgradeFeed replaces the installed version of a feed with feed.
+//
+// The new archive is downloaded and verified before the old version is removed.
+func (c cache) upgradeFeed(ctx context.Context, d *downloader, reg *registry, installed *InstalledFeed, feed *Feed, opts UpdateFeedsOptions) error {
+	fmt.Fprintf(os.Stderr, "Updating %s from %s to %s\n", installed.Name, installed.Version, feed.Version)
+	if c.cachedArchiveMatches(installed.FeedURL, feed) {
+		fmt.Fprintf(os.Stderr, "Archive %s is already cached\n", feedArchiveName(feed))
+	} else if err := c.downloadFeedArchive(ctx, d, installed.FeedURL, feed, opts.VerificationMethod); err != nil {
+		return err
+	}
+	if err := c.installFeed(ctx, reg, installed.FeedURL, feed, installed.Channel, false); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Updated %s to %s\n", feed.Name, feed.Version)
+	return nil
+}
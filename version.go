@@ -0,0 +1,175 @@
+package zerogame
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrDowngrade is returned when installing a feed would replace an installed
+// version with an older one.
+var ErrDowngrade = errors.New("refusing to downgrade")
+
+// Version is a parsed Feed version.
+//
+// Versions are parsed according to Semantic Versioning 2.0.0 with the
+// following extensions for version strings that are not strictly semver:
+//
+//   - A leading "v" or "V" is ignored, so "v1.2.3" is 1.2.3.
+//   - Missing minor and patch numbers are zero, so "1" is 1.0.0 and "1.2" is 1.2.0.
+//   - More than three numbers are allowed, so "1.2.3.4" is newer than "1.2.3".
+//   - Leading zeros are ignored, so "1.02" is 1.2.0.
+//
+// Any other string, such as "latest" or "1.2a", is rejected.
+type Version struct {
+	numbers    []int
+	prerelease []string
+	build      string
+	raw        string
+}
+
+// ParseVersion parses s as a Version.
+func ParseVersion(s string) (Version, error) {
+	v := Version{raw: s}
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.build = rest[i+1:]
+		rest = rest[:i]
+		if !validIdentifiers(v.build) {
+			return Version{}, fmt.Errorf("invalid version %q: invalid build metadata", s)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		prerelease := rest[i+1:]
+		rest = rest[:i]
+		if !validIdentifiers(prerelease) {
+			return Version{}, fmt.Errorf("invalid version %q: invalid pre-release", s)
+		}
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+	for _, part := range strings.Split(rest, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %q is not a number", s, part)
+		}
+		v.numbers = append(v.numbers, n)
+	}
+	for len(v.numbers) < 3 {
+		v.numbers = append(v.numbers, 0)
+	}
+	return v, nil
+}
+
+// String returns the version string v was parsed from.
+func (v Version) String() string {
+	return v.raw
+}
+
+// Compare returns -1, 0 or 1 if v is older than, the same as, or newer than o.
+//
+// Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	for i := 0; i < len(v.numbers) || i < len(o.numbers); i++ {
+		if c := compareInts(numberAt(v.numbers, i), numberAt(o.numbers, i)); c != 0 {
+			return c
+		}
+	}
+	// A version without a pre-release is newer than one with a pre-release.
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(o.prerelease); i++ {
+		if c := compareIdentifiers(v.prerelease[i], o.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.prerelease), len(o.prerelease))
+}
+
+// isDowngrade reports whether replacing the installed version with available
+// would be a downgrade.
+//
+// Versions that cannot be compared are never downgrades.
+func isDowngrade(installed, available string) bool {
+	iv, err := ParseVersion(installed)
+	if err != nil {
+		return false
+	}
+	av, err := ParseVersion(available)
+	if err != nil {
+		return false
+	}
+	return av.Compare(iv) < 0
+}
+
+// sameVersion reports whether a and b are the same version string or parse
+// to equal versions.
+func sameVersion(a, b string) bool {
+	if a == b {
+		return true
+	}
+	av, err := ParseVersion(a)
+	if err != nil {
+		return false
+	}
+	bv, err := ParseVersion(b)
+	if err != nil {
+		return false
+	}
+	return av.Compare(bv) == 0
+}
+
+func numberAt(numbers []int, i int) int {
+	if i < len(numbers) {
+		return numbers[i]
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares two pre-release identifiers.
+//
+// Numeric identifiers are compared numerically and are older than
+// alphanumeric identifiers, which are compared lexically.
+func compareIdentifiers(a, b string) int {
+	an, aErr := strconv.Atoi(a)
+	bn, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareInts(an, bn)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func validIdentifiers(s string) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, r := range id {
+			if !(r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
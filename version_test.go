@@ -0,0 +1,49 @@
+package zerogame
+
+import "testing"
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10", "1.9", 1},
+		{"1.2.3", "1.2.3", 0},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha", 1},
+		{"1.0.0-2", "1.0.0-10", -1},
+		{"1.0.0-rc.1", "1.0.0-1", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"V2", "1.9.9", 1},
+		{"1.2", "1.2.0", 0},
+		{"1", "1.0.1", -1},
+		{"1.2.3.4", "1.2.3", 1},
+		{"1.02", "1.2", 0},
+		{"1.0.0+build.1", "1.0.0+build.2", 0},
+	}
+	for _, tt := range tests {
+		a, err := ParseVersion(tt.a)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) = %v", tt.a, err)
+		}
+		b, err := ParseVersion(tt.b)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) = %v", tt.b, err)
+		}
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%q.Compare(%q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Compare(a); got != -tt.want {
+			t.Errorf("%q.Compare(%q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestParseVersionRejectsInvalidVersions(t *testing.T) {
+	for _, s := range []string{"", "latest", "1.2a", "1..2", "v", "1.0.0-", "1.0.0-beta..1", "1.0.0+", "1.0.0-beta_1"} {
+		if v, err := ParseVersion(s); err == nil {
+			t.Errorf("ParseVersion(%q) = %v, want an error", s, v)
+		}
+	}
+}